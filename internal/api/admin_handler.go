@@ -0,0 +1,204 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/joao-vitor-felix/workout-api/internal/middleware"
+	"github.com/joao-vitor-felix/workout-api/internal/problem"
+	"github.com/joao-vitor-felix/workout-api/internal/store"
+	"github.com/joao-vitor-felix/workout-api/internal/tokens"
+	"github.com/joao-vitor-felix/workout-api/internal/utils"
+)
+
+type AdminHandler struct {
+	userStore    store.UserStore
+	tokenStore   store.TokenStore
+	workoutStore store.WorkoutStore
+	logger       *log.Logger
+}
+
+func NewAdminHandler(userStore store.UserStore, tokenStore store.TokenStore, workoutStore store.WorkoutStore, logger *log.Logger) *AdminHandler {
+	return &AdminHandler{
+		userStore,
+		tokenStore,
+		workoutStore,
+		logger,
+	}
+}
+
+func (h *AdminHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit, err := readIntQuery(query.Get("limit"), defaultListLimit)
+	if err != nil || limit < 1 || limit > maxListLimit {
+		problem.Write(w, r, problem.InvalidParameter, "invalid limit")
+		return
+	}
+
+	offset, err := readIntQuery(query.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		problem.Write(w, r, problem.InvalidParameter, "invalid offset")
+		return
+	}
+
+	users, err := h.userStore.Search(strings.TrimSpace(query.Get("q")), limit, offset)
+	if err != nil {
+		h.logger.Printf("ERROR: search users: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": users})
+}
+
+type setRoleRequest struct {
+	Role string `json:"role"`
+}
+
+func (h *AdminHandler) SetRole(w http.ResponseWriter, r *http.Request) {
+	userId, err := utils.ReadIdParam(r)
+	if err != nil {
+		problem.Write(w, r, problem.InvalidParameter, "invalid user ID")
+		return
+	}
+
+	var req setRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Printf("ERROR: invalid body: %v", err)
+		problem.Write(w, r, problem.InvalidBody, "invalid request body")
+		return
+	}
+
+	if !store.IsValidRole(req.Role) {
+		problem.WriteValidation(w, r, map[string]string{"role": "role must be one of user, coach or admin"})
+		return
+	}
+
+	if int64(middleware.GetUser(r).ID) == userId && req.Role != store.RoleAdmin {
+		problem.Write(w, r, problem.Conflict, "you can't remove your own admin role")
+		return
+	}
+
+	err = h.userStore.SetRole(userId, req.Role)
+	if !h.writeStoreError(w, r, err, "set role") {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (h *AdminHandler) DisableUser(w http.ResponseWriter, r *http.Request) {
+	userId, err := utils.ReadIdParam(r)
+	if err != nil {
+		problem.Write(w, r, problem.InvalidParameter, "invalid user ID")
+		return
+	}
+
+	if int64(middleware.GetUser(r).ID) == userId {
+		problem.Write(w, r, problem.Conflict, "you can't disable your own account")
+		return
+	}
+
+	err = h.userStore.SetDisabled(userId, true)
+	if !h.writeStoreError(w, r, err, "disable user") {
+		return
+	}
+
+	if !h.revokeSessions(w, r, userId) {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (h *AdminHandler) EnableUser(w http.ResponseWriter, r *http.Request) {
+	userId, err := utils.ReadIdParam(r)
+	if err != nil {
+		problem.Write(w, r, problem.InvalidParameter, "invalid user ID")
+		return
+	}
+
+	err = h.userStore.SetDisabled(userId, false)
+	if !h.writeStoreError(w, r, err, "enable user") {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (h *AdminHandler) SignOutUser(w http.ResponseWriter, r *http.Request) {
+	userId, err := utils.ReadIdParam(r)
+	if err != nil {
+		problem.Write(w, r, problem.InvalidParameter, "invalid user ID")
+		return
+	}
+
+	user, err := h.userStore.GetByID(userId)
+	if err != nil {
+		h.logger.Printf("ERROR: get user: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	if user == nil {
+		problem.Write(w, r, problem.NotFound, "user not found")
+		return
+	}
+
+	if !h.revokeSessions(w, r, userId) {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (h *AdminHandler) DeleteWorkout(w http.ResponseWriter, r *http.Request) {
+	workoutId, err := utils.ReadIdParam(r)
+	if err != nil {
+		problem.Write(w, r, problem.InvalidParameter, "invalid workout ID")
+		return
+	}
+
+	// abusive content skips the owner's trash
+	err = h.workoutStore.DeletePermanently(workoutId)
+	if !h.writeStoreError(w, r, err, "delete workout") {
+		return
+	}
+
+	h.logger.Printf("INFO: admin %d deleted workout %d", middleware.GetUser(r).ID, workoutId)
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (h *AdminHandler) revokeSessions(w http.ResponseWriter, r *http.Request, userId int64) bool {
+	for _, scope := range []string{tokens.ScopeAuth, tokens.ScopeRefresh, tokens.ScopeTwoFactor} {
+		err := h.tokenStore.DeleteForUser(int(userId), scope)
+		if err != nil {
+			h.logger.Printf("ERROR: delete tokens for user: %v", err)
+			problem.ServerError(w, r)
+			return false
+		}
+	}
+	return true
+}
+
+// writeStoreError answers for a failed store call and reports whether the
+// handler may go on.
+func (h *AdminHandler) writeStoreError(w http.ResponseWriter, r *http.Request, err error, action string) bool {
+	if err == nil {
+		return true
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Write(w, r, problem.NotFound, "not found")
+		return false
+	}
+
+	h.logger.Printf("ERROR: %s: %v", action, err)
+	problem.ServerError(w, r)
+	return false
+}
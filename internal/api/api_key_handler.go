@@ -0,0 +1,125 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/joao-vitor-felix/workout-api/internal/middleware"
+	"github.com/joao-vitor-felix/workout-api/internal/problem"
+	"github.com/joao-vitor-felix/workout-api/internal/store"
+	"github.com/joao-vitor-felix/workout-api/internal/tokens"
+	"github.com/joao-vitor-felix/workout-api/internal/utils"
+	"github.com/joao-vitor-felix/workout-api/internal/validator"
+)
+
+type APIKeyHandler struct {
+	apiKeyStore store.APIKeyStore
+	logger      *log.Logger
+}
+
+func NewAPIKeyHandler(apiKeyStore store.APIKeyStore, logger *log.Logger) *APIKeyHandler {
+	return &APIKeyHandler{
+		apiKeyStore,
+		logger,
+	}
+}
+
+type createAPIKeyRequest struct {
+	Name        string     `json:"name"`
+	Permissions []string   `json:"permissions"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+}
+
+func validateCreateAPIKeyRequest(v *validator.Validator, req *createAPIKeyRequest) {
+	req.Name = strings.TrimSpace(req.Name)
+	v.Check(req.Name != "", "name", "name is required")
+	v.Check(validator.MaxChars(req.Name, 100), "name", "name must not exceed 100 characters")
+	v.Check(len(req.Permissions) > 0, "permissions", "at least one permission is required")
+	for _, permission := range req.Permissions {
+		v.Check(tokens.IsGrantable(permission), "permissions", "unknown permission "+permission+", expected one of "+strings.Join(tokens.APIKeyPermissions, ", "))
+	}
+	if req.ExpiresAt != nil {
+		v.Check(req.ExpiresAt.After(time.Now()), "expires_at", "expires_at must be in the future")
+	}
+}
+
+func (h *APIKeyHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req createAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Printf("ERROR: invalid body: %v", err)
+		problem.Write(w, r, problem.InvalidBody, "invalid request body")
+		return
+	}
+
+	v := validator.New()
+	if validateCreateAPIKeyRequest(v, &req); !v.Valid() {
+		problem.WriteValidation(w, r, v.Errors)
+		return
+	}
+
+	user := middleware.GetUser(r)
+	token, err := tokens.GenerateAPIKey(user.ID)
+	if err != nil {
+		h.logger.Printf("ERROR: generate api key: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	key := &store.APIKey{
+		UserID:      user.ID,
+		Name:        req.Name,
+		Prefix:      token.PlainText[:tokens.APIKeyDisplayLength],
+		Hash:        token.Hash,
+		Permissions: req.Permissions,
+		ExpiresAt:   req.ExpiresAt,
+	}
+
+	err = h.apiKeyStore.Insert(key)
+	if err != nil {
+		h.logger.Printf("ERROR: create api key: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	// the plain key is only ever shown in this response
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": key, "key": token.PlainText})
+}
+
+func (h *APIKeyHandler) List(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	keys, err := h.apiKeyStore.ListForUser(user.ID)
+	if err != nil {
+		h.logger.Printf("ERROR: list api keys: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": keys})
+}
+
+func (h *APIKeyHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	keyId, err := utils.ReadIdParam(r)
+	if err != nil {
+		problem.Write(w, r, problem.InvalidParameter, "invalid api key ID")
+		return
+	}
+
+	user := middleware.GetUser(r)
+	err = h.apiKeyStore.Delete(user.ID, keyId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, problem.NotFound, "api key not found")
+			return
+		}
+		h.logger.Printf("ERROR: delete api key: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
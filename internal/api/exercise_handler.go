@@ -0,0 +1,291 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/joao-vitor-felix/workout-api/internal/middleware"
+	"github.com/joao-vitor-felix/workout-api/internal/problem"
+	"github.com/joao-vitor-felix/workout-api/internal/store"
+	"github.com/joao-vitor-felix/workout-api/internal/tokens"
+	"github.com/joao-vitor-felix/workout-api/internal/utils"
+	"github.com/joao-vitor-felix/workout-api/internal/validator"
+)
+
+type ExerciseHandler struct {
+	exerciseStore store.ExerciseStore
+	logger        *log.Logger
+}
+
+func NewExerciseHandler(exerciseStore store.ExerciseStore, logger *log.Logger) *ExerciseHandler {
+	return &ExerciseHandler{
+		exerciseStore,
+		logger,
+	}
+}
+
+type exerciseRequest struct {
+	Name         *string  `json:"name"`
+	Aliases      []string `json:"aliases"`
+	MuscleGroups []string `json:"muscle_groups"`
+	Equipment    []string `json:"equipment"`
+	Type         *string  `json:"type"`
+	// Global is only honoured on create, and only for admins.
+	Global bool `json:"global"`
+}
+
+// apply copies the fields present in the request onto exercise. Muscle groups
+// and equipment are lowercased so that filtering on them is predictable.
+func (req *exerciseRequest) apply(exercise *store.Exercise) {
+	if req.Name != nil {
+		exercise.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Aliases != nil {
+		exercise.Aliases = trimAll(req.Aliases, false)
+	}
+	if req.MuscleGroups != nil {
+		exercise.MuscleGroups = trimAll(req.MuscleGroups, true)
+	}
+	if req.Equipment != nil {
+		exercise.Equipment = trimAll(req.Equipment, true)
+	}
+	if req.Type != nil {
+		exercise.Type = *req.Type
+	}
+}
+
+func trimAll(values []string, lower bool) []string {
+	trimmed := make([]string, len(values))
+	for i, value := range values {
+		trimmed[i] = strings.TrimSpace(value)
+		if lower {
+			trimmed[i] = strings.ToLower(trimmed[i])
+		}
+	}
+	return trimmed
+}
+
+func (h *ExerciseHandler) List(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit, err := readIntQuery(query.Get("limit"), defaultListLimit)
+	if err != nil || limit < 1 || limit > maxListLimit {
+		problem.Write(w, r, problem.InvalidParameter, "invalid limit")
+		return
+	}
+
+	offset, err := readIntQuery(query.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		problem.Write(w, r, problem.InvalidParameter, "invalid offset")
+		return
+	}
+
+	filter := store.ExerciseFilter{
+		UserID:      middleware.GetUser(r).ID,
+		Query:       strings.TrimSpace(query.Get("q")),
+		MuscleGroup: strings.TrimSpace(query.Get("muscle_group")),
+		Equipment:   strings.TrimSpace(query.Get("equipment")),
+		Type:        query.Get("type"),
+		Limit:       limit,
+		Offset:      offset,
+	}
+	if filter.Type != "" && !store.IsValidExerciseType(filter.Type) {
+		problem.Write(w, r, problem.InvalidParameter, "type must be one of reps or time")
+		return
+	}
+
+	exercises, err := h.exerciseStore.Search(filter)
+	if err != nil {
+		h.logger.Printf("ERROR: search exercises: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": exercises})
+}
+
+func (h *ExerciseHandler) GetById(w http.ResponseWriter, r *http.Request) {
+	exerciseId, err := utils.ReadIdParam(r)
+	if err != nil {
+		problem.Write(w, r, problem.InvalidParameter, "invalid exercise ID")
+		return
+	}
+
+	exercise, err := h.exerciseStore.GetByID(exerciseId)
+	if err != nil {
+		h.logger.Printf("ERROR: get exercise: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	// other users' private exercises are reported as missing
+	if exercise == nil || (exercise.OwnerID != nil && *exercise.OwnerID != middleware.GetUser(r).ID) {
+		problem.Write(w, r, problem.NotFound, "exercise not found")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": exercise})
+}
+
+// Create adds a private exercise for the current user. Admins can add to the
+// global catalog instead by setting global.
+func (h *ExerciseHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req exerciseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problem.InvalidBody, "invalid request body")
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	exercise := &store.Exercise{Type: store.ExerciseTypeReps}
+	if req.Global {
+		if !isCatalogAdmin(r) {
+			problem.Write(w, r, problem.Forbidden, "only admins can add to the global catalog")
+			return
+		}
+	} else {
+		exercise.OwnerID = &currentUser.ID
+	}
+	req.apply(exercise)
+
+	v := validator.New()
+	if validateExercise(v, exercise); !v.Valid() {
+		problem.WriteValidation(w, r, v.Errors)
+		return
+	}
+
+	created, err := h.exerciseStore.Create(exercise)
+	if err != nil {
+		h.writeStoreError(w, r, err, "create exercise")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": created})
+}
+
+func (h *ExerciseHandler) Update(w http.ResponseWriter, r *http.Request) {
+	exerciseId, err := utils.ReadIdParam(r)
+	if err != nil {
+		problem.Write(w, r, problem.InvalidParameter, "invalid exercise ID")
+		return
+	}
+
+	if !h.checkCanModify(w, r, exerciseId) {
+		return
+	}
+
+	exercise, err := h.exerciseStore.GetByID(exerciseId)
+	if err != nil {
+		h.logger.Printf("ERROR: get exercise: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	if exercise == nil {
+		problem.Write(w, r, problem.NotFound, "exercise not found")
+		return
+	}
+
+	var req exerciseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		problem.Write(w, r, problem.InvalidBody, "invalid request body")
+		return
+	}
+	req.apply(exercise)
+
+	v := validator.New()
+	if validateExercise(v, exercise); !v.Valid() {
+		problem.WriteValidation(w, r, v.Errors)
+		return
+	}
+
+	err = h.exerciseStore.Update(exercise)
+	if err != nil {
+		h.writeStoreError(w, r, err, "update exercise")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": exercise})
+}
+
+func (h *ExerciseHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	exerciseId, err := utils.ReadIdParam(r)
+	if err != nil {
+		problem.Write(w, r, problem.InvalidParameter, "invalid exercise ID")
+		return
+	}
+
+	if !h.checkCanModify(w, r, exerciseId) {
+		return
+	}
+
+	err = h.exerciseStore.Delete(exerciseId)
+	if err != nil {
+		h.writeStoreError(w, r, err, "delete exercise")
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// Promote moves a private exercise to the global catalog. Entries are remapped
+// when the catalog already has an exercise with the same name.
+func (h *ExerciseHandler) Promote(w http.ResponseWriter, r *http.Request) {
+	exerciseId, err := utils.ReadIdParam(r)
+	if err != nil {
+		problem.Write(w, r, problem.InvalidParameter, "invalid exercise ID")
+		return
+	}
+
+	exercise, remapped, err := h.exerciseStore.Promote(exerciseId)
+	if err != nil {
+		h.writeStoreError(w, r, err, "promote exercise")
+		return
+	}
+
+	h.logger.Printf("INFO: admin %d promoted exercise %d to %d, remapping %d entries", middleware.GetUser(r).ID, exerciseId, exercise.ID, remapped)
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": exercise, "remapped_entries": remapped})
+}
+
+// checkCanModify lets owners change their private exercises and admins change
+// the global catalog. Other users' private exercises are reported as missing.
+func (h *ExerciseHandler) checkCanModify(w http.ResponseWriter, r *http.Request, exerciseId int64) bool {
+	ownerId, err := h.exerciseStore.GetExerciseOwner(exerciseId)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		h.logger.Printf("ERROR: get exercise owner: %v", err)
+		problem.ServerError(w, r)
+		return false
+	}
+
+	if err != nil || (ownerId != nil && *ownerId != middleware.GetUser(r).ID) {
+		problem.Write(w, r, problem.NotFound, "exercise not found")
+		return false
+	}
+
+	if ownerId == nil && !isCatalogAdmin(r) {
+		problem.Write(w, r, problem.Forbidden, "only admins can change the global catalog")
+		return false
+	}
+
+	return true
+}
+
+func isCatalogAdmin(r *http.Request) bool {
+	return middleware.GetUser(r).HasRole(store.RoleAdmin) && middleware.GetPermissions(r).Has(tokens.PermissionAdmin)
+}
+
+func (h *ExerciseHandler) writeStoreError(w http.ResponseWriter, r *http.Request, err error, action string) {
+	switch {
+	case errors.Is(err, store.ErrDuplicateExercise), errors.Is(err, store.ErrAlreadyGlobal):
+		problem.Write(w, r, problem.Conflict, err.Error())
+	case errors.Is(err, sql.ErrNoRows):
+		problem.Write(w, r, problem.NotFound, "exercise not found")
+	default:
+		h.logger.Printf("ERROR: %s: %v", action, err)
+		problem.ServerError(w, r)
+	}
+}
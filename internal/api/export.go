@@ -0,0 +1,227 @@
+package api
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/joao-vitor-felix/workout-api/internal/middleware"
+	"github.com/joao-vitor-felix/workout-api/internal/problem"
+	"github.com/joao-vitor-felix/workout-api/internal/store"
+	"github.com/joao-vitor-felix/workout-api/internal/units"
+)
+
+const exportPageSize = 100
+
+// Export streams a ZIP archive with everything stored about the current user.
+// Weights and distances are in the units the request asks for.
+func (h *UserHandler) Export(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+
+	system, ok := requestUnits(w, r)
+	if !ok {
+		return
+	}
+
+	workouts, err := h.allWorkouts(user.ID)
+	if err != nil {
+		h.logger.Printf("ERROR: export workouts: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	sessions, err := h.tokenStore.ListSessions(user.ID, middleware.GetToken(r))
+	if err != nil {
+		h.logger.Printf("ERROR: export sessions: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	workouts = localizeWorkouts(workouts, system)
+
+	filename := fmt.Sprintf("workout-api-export-%s-%s.zip", user.Username, time.Now().UTC().Format("20060102"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.WriteHeader(http.StatusOK)
+
+	archive := zip.NewWriter(w)
+	files := []struct {
+		name  string
+		write func(io.Writer) error
+	}{
+		{"profile.json", jsonFile(user)},
+		{"workouts.json", jsonFile(workouts)},
+		{"workouts.csv", func(out io.Writer) error { return writeWorkoutsCSV(out, workouts) }},
+		{"workout_entries.csv", func(out io.Writer) error { return writeEntriesCSV(out, workouts, system) }},
+		{"workout_sets.csv", func(out io.Writer) error { return writeSetsCSV(out, workouts, system) }},
+		{"sessions.json", jsonFile(sessions)},
+		{"sessions.csv", func(out io.Writer) error { return writeSessionsCSV(out, sessions) }},
+	}
+
+	for _, file := range files {
+		out, err := archive.Create(file.name)
+		if err == nil {
+			err = file.write(out)
+		}
+		if err != nil {
+			// the status is already sent, all we can do is cut the archive short
+			h.logger.Printf("ERROR: export %s: %v", file.name, err)
+			return
+		}
+	}
+
+	if err = archive.Close(); err != nil {
+		h.logger.Printf("ERROR: export close archive: %v", err)
+	}
+}
+
+// allWorkouts returns every workout of the user, including the ones in the trash.
+func (h *UserHandler) allWorkouts(userId int) ([]*store.Workout, error) {
+	workouts := []*store.Workout{}
+	for _, trashed := range []bool{false, true} {
+		filter := store.WorkoutFilter{Limit: exportPageSize, Trashed: trashed}
+		for {
+			page, next, err := h.workoutStore.ListByUser(userId, filter)
+			if err != nil {
+				return nil, err
+			}
+			workouts = append(workouts, page...)
+			if next == nil {
+				break
+			}
+			filter.Cursor = next
+		}
+	}
+	return workouts, nil
+}
+
+func jsonFile(data any) func(io.Writer) error {
+	return func(out io.Writer) error {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", " ")
+		return encoder.Encode(data)
+	}
+}
+
+func writeWorkoutsCSV(out io.Writer, workouts []*store.Workout) error {
+	writer := csv.NewWriter(out)
+	writer.Write([]string{"id", "title", "description", "duration_minutes", "calories_burned", "visibility", "created_at"})
+	for _, workout := range workouts {
+		writer.Write([]string{
+			strconv.Itoa(workout.ID),
+			workout.Title,
+			workout.Description,
+			strconv.Itoa(workout.DurationMinutes),
+			strconv.Itoa(workout.CaloriesBurned),
+			workout.Visibility,
+			workout.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeEntriesCSV writes entries whose weights and distances are in system,
+// naming the units in the column headers.
+func writeEntriesCSV(out io.Writer, workouts []*store.Workout, system string) error {
+	writer := csv.NewWriter(out)
+	writer.Write([]string{"workout_id", "id", "exercise_id", "exercise_name", "sets", "reps", "duration_seconds", "weight_" + units.WeightUnit(system), "distance_" + units.DistanceUnit(system), "notes", "order_index", "group"})
+	for _, workout := range workouts {
+		for _, entry := range workout.Entries {
+			writer.Write([]string{
+				strconv.Itoa(workout.ID),
+				strconv.Itoa(entry.ID),
+				optionalInt(entry.ExerciseID),
+				entry.ExerciseName,
+				strconv.Itoa(entry.Sets),
+				optionalInt(entry.Reps),
+				optionalInt(entry.DurationSeconds),
+				optionalFloat(entry.Weight),
+				optionalFloat(entry.Distance),
+				entry.Notes,
+				strconv.Itoa(entry.OrderIndex),
+				optionalString(entry.Group),
+			})
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func writeSetsCSV(out io.Writer, workouts []*store.Workout, system string) error {
+	writer := csv.NewWriter(out)
+	writer.Write([]string{"workout_id", "entry_id", "set_number", "type", "reps", "duration_seconds", "weight_" + units.WeightUnit(system), "distance_" + units.DistanceUnit(system), "rpe", "rir", "completed"})
+	for _, workout := range workouts {
+		for _, entry := range workout.Entries {
+			for _, set := range entry.SetDetails {
+				completed := ""
+				if set.Completed != nil {
+					completed = strconv.FormatBool(*set.Completed)
+				}
+				writer.Write([]string{
+					strconv.Itoa(workout.ID),
+					strconv.Itoa(entry.ID),
+					strconv.Itoa(set.SetNumber),
+					set.Type,
+					optionalInt(set.Reps),
+					optionalInt(set.DurationSeconds),
+					optionalFloat(set.Weight),
+					optionalFloat(set.Distance),
+					optionalFloat(set.RPE),
+					optionalInt(set.RIR),
+					completed,
+				})
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func writeSessionsCSV(out io.Writer, sessions []*store.Session) error {
+	writer := csv.NewWriter(out)
+	writer.Write([]string{"id", "device_label", "user_agent", "ip_address", "created_at", "last_used_at", "expires_at"})
+	for _, session := range sessions {
+		lastUsedAt := ""
+		if session.LastUsedAt != nil {
+			lastUsedAt = session.LastUsedAt.Format(time.RFC3339)
+		}
+		writer.Write([]string{
+			strconv.Itoa(session.ID),
+			session.DeviceLabel,
+			session.UserAgent,
+			session.IPAddress,
+			session.CreatedAt.Format(time.RFC3339),
+			lastUsedAt,
+			session.ExpiresAt.Format(time.RFC3339),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func optionalInt(value *int) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.Itoa(*value)
+}
+
+func optionalString(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
+
+func optionalFloat(value *float64) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*value, 'f', -1, 64)
+}
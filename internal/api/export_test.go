@@ -0,0 +1,39 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"io"
+	"testing"
+
+	"github.com/joao-vitor-felix/workout-api/internal/store"
+	"github.com/joao-vitor-felix/workout-api/internal/units"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportCSVUnitHeaders(t *testing.T) {
+	workouts := []*store.Workout{{ID: 1, Entries: []store.WorkoutEntry{{ID: 2, ExerciseName: "Squat", Sets: 1, Reps: intPtr(5)}}}}
+
+	tests := []struct {
+		name   string
+		write  func(io.Writer, []*store.Workout, string) error
+		system string
+		want   []string
+	}{
+		{"entries in metric", writeEntriesCSV, units.Metric, []string{"weight_kg", "distance_km"}},
+		{"entries in imperial", writeEntriesCSV, units.Imperial, []string{"weight_lb", "distance_mi"}},
+		{"sets in imperial", writeSetsCSV, units.Imperial, []string{"weight_lb", "distance_mi"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			require.NoError(t, tt.write(&out, workouts, tt.system))
+
+			header, err := csv.NewReader(&out).Read()
+			require.NoError(t, err)
+			assert.Subset(t, header, tt.want)
+		})
+	}
+}
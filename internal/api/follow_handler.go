@@ -0,0 +1,71 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/joao-vitor-felix/workout-api/internal/middleware"
+	"github.com/joao-vitor-felix/workout-api/internal/problem"
+	"github.com/joao-vitor-felix/workout-api/internal/store"
+	"github.com/joao-vitor-felix/workout-api/internal/utils"
+)
+
+type FollowHandler struct {
+	followStore store.FollowStore
+	logger      *log.Logger
+}
+
+func NewFollowHandler(followStore store.FollowStore, logger *log.Logger) *FollowHandler {
+	return &FollowHandler{
+		followStore,
+		logger,
+	}
+}
+
+// Follow lets the current user see the followers-only workouts of the user
+// in the URL.
+func (h *FollowHandler) Follow(w http.ResponseWriter, r *http.Request) {
+	userId, err := utils.ReadIdParam(r)
+	if err != nil {
+		problem.Write(w, r, problem.InvalidParameter, "invalid user ID")
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if int64(currentUser.ID) == userId {
+		problem.Write(w, r, problem.Conflict, "you can't follow yourself")
+		return
+	}
+
+	err = h.followStore.Follow(currentUser.ID, int(userId))
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Write(w, r, problem.NotFound, "user not found")
+		return
+	}
+	if err != nil {
+		h.logger.Printf("ERROR: follow user: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (h *FollowHandler) Unfollow(w http.ResponseWriter, r *http.Request) {
+	userId, err := utils.ReadIdParam(r)
+	if err != nil {
+		problem.Write(w, r, problem.InvalidParameter, "invalid user ID")
+		return
+	}
+
+	err = h.followStore.Unfollow(middleware.GetUser(r).ID, int(userId))
+	if err != nil {
+		h.logger.Printf("ERROR: unfollow user: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
@@ -1,68 +1,436 @@
 package api
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/joao-vitor-felix/workout-api/internal/middleware"
+	"github.com/joao-vitor-felix/workout-api/internal/problem"
 	"github.com/joao-vitor-felix/workout-api/internal/store"
 	"github.com/joao-vitor-felix/workout-api/internal/tokens"
+	"github.com/joao-vitor-felix/workout-api/internal/totp"
 	"github.com/joao-vitor-felix/workout-api/internal/utils"
 )
 
 type TokenHandler struct {
-	tokenStore store.TokenStore
-	userStore  store.UserStore
-	logger     *log.Logger
+	tokenStore        store.TokenStore
+	userStore         store.UserStore
+	loginAttemptStore store.LoginAttemptStore
+	twoFactorStore    store.TwoFactorStore
+	logger            *log.Logger
 }
 
 type createTokenRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
+	Device   string `json:"device"`
+}
+
+const (
+	maxDeviceLabelLength = 100
+	accessTokenTTL       = 15 * time.Minute
+	refreshTokenTTL      = 30 * 24 * time.Hour
+	twoFactorTokenTTL    = 5 * time.Minute
+)
+
+// Failed sign-ins are counted per username and per client IP. Once a key goes
+// over its threshold it is locked for lockoutBaseDelay, doubling with every
+// further failure up to lockoutMaxDelay.
+const (
+	usernameFailureThreshold = 5
+	ipFailureThreshold       = 20
+	lockoutBaseDelay         = 30 * time.Second
+	lockoutMaxDelay          = time.Hour
+	failureWindow            = time.Hour
+)
+
+type attemptKey struct {
+	key       string
+	threshold int
+}
+
+func signInAttemptKeys(r *http.Request, username string) []attemptKey {
+	return []attemptKey{
+		{"username:" + strings.ToLower(username), usernameFailureThreshold},
+		{"ip:" + utils.ClientIP(r), ipFailureThreshold},
+	}
+}
+
+// checkLockout answers 429 and returns false when any of keys is locked.
+func (h *TokenHandler) checkLockout(w http.ResponseWriter, r *http.Request, keys []attemptKey) bool {
+	names := make([]string, len(keys))
+	for i, k := range keys {
+		names[i] = k.key
+	}
+
+	now := time.Now()
+	lockedUntil, err := h.loginAttemptStore.LockedUntil(names, now)
+	if err != nil {
+		h.logger.Printf("ERROR: check login lockout: %v", err)
+		problem.ServerError(w, r)
+		return false
+	}
+
+	if lockedUntil != nil {
+		retryAfter := int(math.Ceil(lockedUntil.Sub(now).Seconds()))
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		problem.Write(w, r, problem.TooManyRequests, "too many failed attempts, try again later")
+		return false
+	}
+
+	return true
+}
+
+func (h *TokenHandler) recordLoginFailure(keys []attemptKey) {
+	now := time.Now()
+	for _, k := range keys {
+		failures, err := h.loginAttemptStore.RecordFailure(k.key, now, failureWindow)
+		if err != nil {
+			h.logger.Printf("ERROR: record login failure: %v", err)
+			continue
+		}
+
+		if failures < k.threshold {
+			continue
+		}
+
+		delay := lockoutMaxDelay
+		if exponent := failures - k.threshold; exponent < 16 {
+			delay = min(lockoutBaseDelay<<exponent, lockoutMaxDelay)
+		}
+
+		err = h.loginAttemptStore.Lock(k.key, now.Add(delay))
+		if err != nil {
+			h.logger.Printf("ERROR: lock login key: %v", err)
+		}
+	}
 }
 
 func (h *TokenHandler) Create(w http.ResponseWriter, r *http.Request) {
 	var req createTokenRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.logger.Printf("ERROR: invalid body: %v", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request body"})
+		problem.Write(w, r, problem.InvalidBody, "invalid request body")
+		return
+	}
+
+	attemptKeys := signInAttemptKeys(r, req.Username)
+	if !h.checkLockout(w, r, attemptKeys) {
 		return
 	}
 
 	user, err := h.userStore.GetByUsername(req.Username)
-	if err != nil || user == nil {
+	if err != nil {
 		h.logger.Printf("ERROR: get user: %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		problem.ServerError(w, r)
+		return
+	}
+
+	if user == nil {
+		store.CheckDummyPassword(req.Password)
+		h.recordLoginFailure(attemptKeys)
+		problem.Write(w, r, problem.InvalidCredentials, "invalid credentials")
 		return
 	}
 
 	doesPasswordMatch, err := user.PasswordHash.Check(req.Password)
 	if err != nil {
 		h.logger.Printf("ERROR: check password: %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		problem.ServerError(w, r)
 		return
 	}
 
 	if !doesPasswordMatch {
-		utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid credentials"})
+		h.recordLoginFailure(attemptKeys)
+		problem.Write(w, r, problem.InvalidCredentials, "invalid credentials")
+		return
+	}
+
+	if user.IsDisabled() {
+		problem.Write(w, r, problem.AccountDisabled, "this account has been disabled")
+		return
+	}
+
+	// only the username counter is cleared, an IP may be trying many accounts
+	err = h.loginAttemptStore.Reset(attemptKeys[0].key)
+	if err != nil {
+		h.logger.Printf("ERROR: reset login attempts: %v", err)
+	}
+
+	if user.TwoFactorEnabled {
+		pending, err := h.tokenStore.Create(user.ID, twoFactorTokenTTL, tokens.ScopeTwoFactor)
+		if err != nil {
+			h.logger.Printf("ERROR: create two-factor token: %v", err)
+			problem.ServerError(w, r)
+			return
+		}
+
+		utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+			"two_factor_required": true,
+			"token":               pending.PlainText,
+			"expires_at":          pending.ExpiresAt,
+		})
+		return
+	}
+
+	access, refresh, err := h.createSession(r, user.ID, req.Device)
+	if err != nil {
+		h.logger.Printf("ERROR: create session: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	writeTokenPair(w, http.StatusCreated, access, refresh)
+}
+
+type verifyTwoFactorRequest struct {
+	Token        string `json:"token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+	Device       string `json:"device"`
+}
+
+func (h *TokenHandler) VerifyTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req verifyTwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Printf("ERROR: invalid body: %v", err)
+		problem.Write(w, r, problem.InvalidBody, "invalid request body")
+		return
+	}
+
+	if req.Code == "" && req.RecoveryCode == "" {
+		problem.WriteValidation(w, r, map[string]string{"code": "code or recovery_code is required"})
+		return
+	}
+
+	user, err := h.userStore.GetUserToken(tokens.ScopeTwoFactor, req.Token)
+	if err != nil {
+		h.logger.Printf("ERROR: get two-factor token: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	if user == nil {
+		problem.Write(w, r, problem.InvalidToken, "invalid or expired token")
+		return
+	}
+
+	attemptKeys := []attemptKey{
+		{"2fa:" + strconv.Itoa(user.ID), usernameFailureThreshold},
+		{"ip:" + utils.ClientIP(r), ipFailureThreshold},
+	}
+	if !h.checkLockout(w, r, attemptKeys) {
+		return
+	}
+
+	twoFactor, err := h.twoFactorStore.Get(user.ID)
+	if err != nil {
+		h.logger.Printf("ERROR: get two-factor settings: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	if twoFactor == nil || twoFactor.EnabledAt == nil {
+		problem.Write(w, r, problem.InvalidToken, "invalid or expired token")
+		return
+	}
+
+	var verified bool
+	if req.Code != "" {
+		if step, ok := totp.Validate(twoFactor.Secret, req.Code, time.Now()); ok {
+			verified, err = h.twoFactorStore.UseStep(user.ID, step)
+		}
+	} else {
+		verified, err = h.twoFactorStore.UseRecoveryCode(user.ID, req.RecoveryCode)
+	}
+
+	if err != nil {
+		h.logger.Printf("ERROR: verify two-factor code: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	if !verified {
+		h.recordLoginFailure(attemptKeys)
+		problem.Write(w, r, problem.InvalidCredentials, "invalid code")
+		return
+	}
+
+	err = h.loginAttemptStore.Reset(attemptKeys[0].key)
+	if err != nil {
+		h.logger.Printf("ERROR: reset login attempts: %v", err)
+	}
+
+	err = h.tokenStore.Delete(req.Token)
+	if err != nil {
+		h.logger.Printf("ERROR: delete two-factor token: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	access, refresh, err := h.createSession(r, user.ID, req.Device)
+	if err != nil {
+		h.logger.Printf("ERROR: create session: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	writeTokenPair(w, http.StatusCreated, access, refresh)
+}
+
+type refreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+func (h *TokenHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req refreshTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		problem.WriteValidation(w, r, map[string]string{"refresh_token": "refresh_token is required"})
 		return
 	}
 
-	token, err := h.tokenStore.Create(user.ID, 24*time.Hour, tokens.ScopeAuth)
+	access, refresh, err := h.tokenStore.Rotate(req.RefreshToken, accessTokenTTL, refreshTokenTTL, r.UserAgent(), utils.ClientIP(r))
 	if err != nil {
-		h.logger.Printf("ERROR: create token: %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		switch {
+		case errors.Is(err, store.ErrTokenReused):
+			h.logger.Printf("WARN: refresh token reuse detected, token family revoked")
+			problem.Write(w, r, problem.TokenReused, "refresh token already used, please sign in again")
+		case errors.Is(err, store.ErrInvalidToken):
+			problem.Write(w, r, problem.InvalidToken, "invalid or expired refresh token")
+		default:
+			h.logger.Printf("ERROR: rotate refresh token: %v", err)
+			problem.ServerError(w, r)
+		}
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"token": token.PlainText, "expires_at": token.ExpiresAt})
+	writeTokenPair(w, http.StatusOK, access, refresh)
+}
+
+// createSession issues a short-lived access token and a refresh token sharing
+// a new token family.
+func (h *TokenHandler) createSession(r *http.Request, userId int, device string) (*tokens.Token, *tokens.Token, error) {
+	familyId, err := tokens.NewFamilyID()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	issued := make([]*tokens.Token, 0, 2)
+	for _, spec := range []struct {
+		ttl   time.Duration
+		scope string
+	}{
+		{accessTokenTTL, tokens.ScopeAuth},
+		{refreshTokenTTL, tokens.ScopeRefresh},
+	} {
+		token, err := tokens.GenerateToken(userId, spec.ttl, spec.scope)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		token.FamilyID = familyId
+		token.DeviceLabel = truncate(device, maxDeviceLabelLength)
+		token.UserAgent = r.UserAgent()
+		token.IPAddress = utils.ClientIP(r)
+
+		if err = h.tokenStore.Insert(token); err != nil {
+			return nil, nil, err
+		}
+		issued = append(issued, token)
+	}
+
+	return issued[0], issued[1], nil
+}
+
+func writeTokenPair(w http.ResponseWriter, status int, access, refresh *tokens.Token) {
+	utils.WriteJSON(w, status, utils.Envelope{
+		"token":              access.PlainText,
+		"expires_at":         access.ExpiresAt,
+		"refresh_token":      refresh.PlainText,
+		"refresh_expires_at": refresh.ExpiresAt,
+	})
+}
+
+func (h *TokenHandler) SignOut(w http.ResponseWriter, r *http.Request) {
+	err := h.tokenStore.Delete(middleware.GetToken(r))
+	if err != nil {
+		h.logger.Printf("ERROR: delete token: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (h *TokenHandler) SignOutAll(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	for _, scope := range []string{tokens.ScopeAuth, tokens.ScopeRefresh} {
+		err := h.tokenStore.DeleteForUser(user.ID, scope)
+		if err != nil {
+			h.logger.Printf("ERROR: delete tokens for user: %v", err)
+			problem.ServerError(w, r)
+			return
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (h *TokenHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	sessions, err := h.tokenStore.ListSessions(user.ID, middleware.GetToken(r))
+	if err != nil {
+		h.logger.Printf("ERROR: list sessions: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": sessions})
+}
+
+func (h *TokenHandler) DeleteSession(w http.ResponseWriter, r *http.Request) {
+	sessionId, err := utils.ReadIdParam(r)
+	if err != nil {
+		problem.Write(w, r, problem.InvalidParameter, "invalid session ID")
+		return
+	}
+
+	user := middleware.GetUser(r)
+	err = h.tokenStore.DeleteSession(user.ID, sessionId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, problem.NotFound, "session not found")
+			return
+		}
+		h.logger.Printf("ERROR: delete session: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max])
 }
 
-func NewTokenHandler(tokenStore store.TokenStore, userStore store.UserStore, logger *log.Logger) *TokenHandler {
+func NewTokenHandler(tokenStore store.TokenStore, userStore store.UserStore, loginAttemptStore store.LoginAttemptStore, twoFactorStore store.TwoFactorStore, logger *log.Logger) *TokenHandler {
 	return &TokenHandler{
 		tokenStore,
 		userStore,
+		loginAttemptStore,
+		twoFactorStore,
 		logger,
 	}
 }
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/joao-vitor-felix/workout-api/internal/middleware"
+	"github.com/joao-vitor-felix/workout-api/internal/problem"
+	"github.com/joao-vitor-felix/workout-api/internal/store"
+	"github.com/joao-vitor-felix/workout-api/internal/totp"
+	"github.com/joao-vitor-felix/workout-api/internal/utils"
+)
+
+const (
+	totpIssuer        = "Workout API"
+	recoveryCodeCount = 10
+)
+
+type TwoFactorHandler struct {
+	twoFactorStore store.TwoFactorStore
+	logger         *log.Logger
+}
+
+func NewTwoFactorHandler(twoFactorStore store.TwoFactorStore, logger *log.Logger) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		twoFactorStore,
+		logger,
+	}
+}
+
+func (h *TwoFactorHandler) Enroll(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user.TwoFactorEnabled {
+		problem.Write(w, r, problem.Conflict, "two-factor authentication is already enabled")
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		h.logger.Printf("ERROR: generate totp secret: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	err = h.twoFactorStore.SetPendingSecret(user.ID, secret)
+	if err != nil {
+		h.logger.Printf("ERROR: store totp secret: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{
+		"secret":      secret,
+		"otpauth_uri": totp.URI(totpIssuer, user.Username, secret),
+	})
+}
+
+type confirmTwoFactorRequest struct {
+	Code string `json:"code"`
+}
+
+func (h *TwoFactorHandler) Confirm(w http.ResponseWriter, r *http.Request) {
+	var req confirmTwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Printf("ERROR: invalid body: %v", err)
+		problem.Write(w, r, problem.InvalidBody, "invalid request body")
+		return
+	}
+
+	user := middleware.GetUser(r)
+	twoFactor, err := h.twoFactorStore.Get(user.ID)
+	if err != nil {
+		h.logger.Printf("ERROR: get two-factor settings: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	if twoFactor == nil {
+		problem.Write(w, r, problem.Conflict, "two-factor enrollment has not been started")
+		return
+	}
+
+	if twoFactor.EnabledAt != nil {
+		problem.Write(w, r, problem.Conflict, "two-factor authentication is already enabled")
+		return
+	}
+
+	step, ok := totp.Validate(twoFactor.Secret, req.Code, time.Now())
+	if !ok {
+		problem.WriteValidation(w, r, map[string]string{"code": "invalid code"})
+		return
+	}
+
+	recoveryCodes, err := totp.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		h.logger.Printf("ERROR: generate recovery codes: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	err = h.twoFactorStore.Enable(user.ID, recoveryCodes)
+	if err != nil {
+		h.logger.Printf("ERROR: enable two-factor: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	// the confirmation code can't be replayed at sign-in
+	if _, err = h.twoFactorStore.UseStep(user.ID, step); err != nil {
+		h.logger.Printf("ERROR: record totp step: %v", err)
+	}
+
+	// recovery codes are only stored hashed, this is the only time they are shown
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"recovery_codes": recoveryCodes})
+}
+
+type disableTwoFactorRequest struct {
+	Password string `json:"password"`
+}
+
+func (h *TwoFactorHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	var req disableTwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Printf("ERROR: invalid body: %v", err)
+		problem.Write(w, r, problem.InvalidBody, "invalid request body")
+		return
+	}
+
+	user := middleware.GetUser(r)
+	doesPasswordMatch, err := user.PasswordHash.Check(req.Password)
+	if err != nil {
+		h.logger.Printf("ERROR: check password: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	if !doesPasswordMatch {
+		problem.Write(w, r, problem.InvalidCredentials, "password is incorrect")
+		return
+	}
+
+	err = h.twoFactorStore.Disable(user.ID)
+	if err != nil {
+		h.logger.Printf("ERROR: disable two-factor: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/joao-vitor-felix/workout-api/internal/middleware"
+	"github.com/joao-vitor-felix/workout-api/internal/problem"
+	"github.com/joao-vitor-felix/workout-api/internal/store"
+	"github.com/joao-vitor-felix/workout-api/internal/units"
+)
+
+const unitsHeader = "X-Units"
+
+// requestUnits picks the unit system weights and distances are read and
+// written in: the units query parameter, then the X-Units header, then the
+// user's preference. The choice is echoed back in X-Units.
+func requestUnits(w http.ResponseWriter, r *http.Request) (string, bool) {
+	system := r.URL.Query().Get("units")
+	if system == "" {
+		system = r.Header.Get(unitsHeader)
+	}
+	if user := middleware.GetUser(r); system == "" && user != nil {
+		system = user.Units
+	}
+	if system == "" {
+		system = units.Metric
+	}
+
+	if !units.IsValid(system) {
+		problem.Write(w, r, problem.InvalidParameter, "units must be one of metric or imperial")
+		return "", false
+	}
+
+	w.Header().Set(unitsHeader, system)
+	w.Header().Add("Vary", unitsHeader)
+	return system, true
+}
+
+func convertValue(value *float64, convert func(float64, string) float64, system string) *float64 {
+	if value == nil {
+		return nil
+	}
+	converted := convert(*value, system)
+	return &converted
+}
+
+// localizeEntry returns a copy of a stored entry with its weights and
+// distances in system.
+func localizeEntry(entry store.WorkoutEntry, system string) store.WorkoutEntry {
+	entry.Weight = convertValue(entry.Weight, units.FromKilograms, system)
+	entry.Distance = convertValue(entry.Distance, units.FromMeters, system)
+
+	if entry.SetDetails != nil {
+		sets := make([]store.WorkoutSet, len(entry.SetDetails))
+		for i, set := range entry.SetDetails {
+			set.Weight = convertValue(set.Weight, units.FromKilograms, system)
+			set.Distance = convertValue(set.Distance, units.FromMeters, system)
+			sets[i] = set
+		}
+		entry.SetDetails = sets
+	}
+	return entry
+}
+
+// localizeWorkout returns a copy of a stored workout with its weights and
+// distances in system.
+func localizeWorkout(workout *store.Workout, system string) *store.Workout {
+	if workout == nil {
+		return nil
+	}
+
+	localized := *workout
+	if workout.Entries != nil {
+		localized.Entries = make([]store.WorkoutEntry, len(workout.Entries))
+		for i, entry := range workout.Entries {
+			localized.Entries[i] = localizeEntry(entry, system)
+		}
+	}
+	return &localized
+}
+
+func localizeWorkouts(workouts []*store.Workout, system string) []*store.Workout {
+	localized := make([]*store.Workout, len(workouts))
+	for i, workout := range workouts {
+		localized[i] = localizeWorkout(workout, system)
+	}
+	return localized
+}
+
+// canonicalValue converts a weight or distance given in system to the unit it
+// is stored in. A value sent back the way stored was shown keeps stored, so
+// that reading and writing a workout doesn't shift it by the display rounding.
+func canonicalValue(value, stored *float64, display, convert func(float64, string) float64, system string) *float64 {
+	if value == nil {
+		return nil
+	}
+	if stored != nil && display(*stored, system) == *value {
+		kept := *stored
+		return &kept
+	}
+	converted := convert(*value, system)
+	return &converted
+}
+
+// canonicalizeEntry converts the weights and distances of an entry given in
+// system to the kilograms and meters they are stored in. stored is the entry
+// as it was before the change, or nil for a new one; its sets are paired with
+// the entry's by position.
+func canonicalizeEntry(entry *store.WorkoutEntry, stored *store.WorkoutEntry, system string) {
+	if stored == nil {
+		stored = &store.WorkoutEntry{}
+	}
+
+	entry.Weight = canonicalValue(entry.Weight, stored.Weight, units.FromKilograms, units.ToKilograms, system)
+	entry.Distance = canonicalValue(entry.Distance, stored.Distance, units.FromMeters, units.ToMeters, system)
+	for i := range entry.SetDetails {
+		set := &entry.SetDetails[i]
+		var storedSet store.WorkoutSet
+		if i < len(stored.SetDetails) {
+			storedSet = stored.SetDetails[i]
+		}
+		set.Weight = canonicalValue(set.Weight, storedSet.Weight, units.FromKilograms, units.ToKilograms, system)
+		set.Distance = canonicalValue(set.Distance, storedSet.Distance, units.FromMeters, units.ToMeters, system)
+	}
+}
+
+// canonicalizeEntries converts entries given in system, pairing them with the
+// stored ones by ID.
+func canonicalizeEntries(entries []store.WorkoutEntry, stored []store.WorkoutEntry, system string) {
+	storedByID := make(map[int]*store.WorkoutEntry, len(stored))
+	for i := range stored {
+		storedByID[stored[i].ID] = &stored[i]
+	}
+
+	for i := range entries {
+		var previous *store.WorkoutEntry
+		if entries[i].ID != 0 {
+			previous = storedByID[entries[i].ID]
+		}
+		canonicalizeEntry(&entries[i], previous, system)
+	}
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/joao-vitor-felix/workout-api/internal/store"
+	"github.com/joao-vitor-felix/workout-api/internal/units"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
+func TestCanonicalizeRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		weight   float64
+		distance float64
+		system   string
+	}{
+		{"pounds read back in kilograms", 102.058, 0, units.Metric},
+		{"kilograms read back in pounds", 100, 0, units.Imperial},
+		{"kilograms read back in kilograms", 82.555, 0, units.Metric},
+		{"meters read back in kilometers", 0, 5000.4, units.Metric},
+		{"meters read back in miles", 0, 10000.25, units.Imperial},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored := store.WorkoutEntry{ID: 1, ExerciseName: "Sled Push", Sets: 2, Reps: intPtr(5)}
+			if tt.weight != 0 {
+				stored.Weight = floatPtr(tt.weight)
+			}
+			if tt.distance != 0 {
+				stored.Distance = floatPtr(tt.distance)
+			}
+			stored.SetDetails = []store.WorkoutSet{
+				{SetNumber: 1, Type: store.SetTypeWorking, Reps: intPtr(5), Weight: stored.Weight, Distance: stored.Distance},
+				{SetNumber: 2, Type: store.SetTypeWorking, Reps: intPtr(5), Weight: stored.Weight, Distance: stored.Distance},
+			}
+
+			// a title change sends every entry back the way it was shown
+			entries := localizeWorkout(&store.Workout{Entries: []store.WorkoutEntry{stored}}, tt.system).Entries
+			canonicalizeEntries(entries, []store.WorkoutEntry{stored}, tt.system)
+
+			require.Len(t, entries, 1)
+			assert.Equal(t, stored.Weight, entries[0].Weight)
+			assert.Equal(t, stored.Distance, entries[0].Distance)
+			for i, set := range entries[0].SetDetails {
+				assert.Equal(t, stored.SetDetails[i].Weight, set.Weight)
+				assert.Equal(t, stored.SetDetails[i].Distance, set.Distance)
+			}
+		})
+	}
+}
+
+func TestCanonicalizeChangedValue(t *testing.T) {
+	stored := store.WorkoutEntry{ID: 1, ExerciseName: "Squat", Sets: 3, Reps: intPtr(5), Weight: floatPtr(102.058)}
+
+	entry := localizeEntry(stored, units.Imperial)
+	entry.Weight = floatPtr(230)
+	canonicalizeEntry(&entry, &stored, units.Imperial)
+
+	assert.Equal(t, 104.326, *entry.Weight)
+
+	// a new entry has nothing to pair with, even when its value happens to
+	// match a stored one
+	added := []store.WorkoutEntry{{ExerciseName: "Row", Sets: 3, Reps: intPtr(8), Weight: floatPtr(225)}}
+	canonicalizeEntries(added, []store.WorkoutEntry{stored}, units.Imperial)
+
+	assert.Equal(t, 102.058, *added[0].Weight)
+}
@@ -1,14 +1,22 @@
 package api
 
 import (
+	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
-	"regexp"
+	"net/url"
+	"time"
 
+	"github.com/joao-vitor-felix/workout-api/internal/mailer"
+	"github.com/joao-vitor-felix/workout-api/internal/middleware"
+	"github.com/joao-vitor-felix/workout-api/internal/problem"
 	"github.com/joao-vitor-felix/workout-api/internal/store"
+	"github.com/joao-vitor-felix/workout-api/internal/tokens"
 	"github.com/joao-vitor-felix/workout-api/internal/utils"
+	"github.com/joao-vitor-felix/workout-api/internal/validator"
 )
 
 type registerUserRequest struct {
@@ -16,70 +24,65 @@ type registerUserRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
 	Bio      string `json:"bio,omitempty"`
+	Units    string `json:"units,omitempty"`
 }
 
 type UserHandler struct {
-	userStore store.UserStore
-	logger    *log.Logger
+	userStore    store.UserStore
+	tokenStore   store.TokenStore
+	workoutStore store.WorkoutStore
+	mailer       mailer.Mailer
+	appURL       string
+	logger       *log.Logger
 }
 
-func NewUserHandler(userStore store.UserStore, logger *log.Logger) *UserHandler {
+func NewUserHandler(userStore store.UserStore, tokenStore store.TokenStore, workoutStore store.WorkoutStore, mailer mailer.Mailer, appURL string, logger *log.Logger) *UserHandler {
 	return &UserHandler{
 		userStore,
+		tokenStore,
+		workoutStore,
+		mailer,
+		appURL,
 		logger,
 	}
 }
 
-func (h *UserHandler) validateRegisterUserRequest(req *registerUserRequest) error {
-	if req.Username == "" {
-		return errors.New("username is required")
-	}
-	if req.Email == "" {
-		return errors.New("email is required")
-	}
-	if len(req.Email) > 255 {
-		return errors.New("email must not exceed 255 characters")
-	}
-	emailRegex := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
-	if !emailRegex.MatchString(req.Email) {
-		return errors.New("invalid email format")
-	}
-	if req.Password == "" {
-		return errors.New("password is required")
-	}
-	if len(req.Password) < 6 {
-		return errors.New("password must be at least 6 characters long")
-	}
-	if len(req.Username) < 3 {
-		return errors.New("username must be at least 3 characters long")
-	}
-	if len(req.Username) > 20 {
-		return errors.New("username must not exceed 20 characters")
+const (
+	passwordResetTTL = 30 * time.Minute
+	activationTTL    = 72 * time.Hour
+)
+
+func validateRegisterUserRequest(v *validator.Validator, req *registerUserRequest) {
+	validateUsername(v, req.Username)
+	validateEmail(v, req.Email)
+	validatePassword(v, "password", req.Password)
+	if req.Units != "" {
+		validateUnits(v, req.Units)
 	}
-	return nil
 }
 
 func (h *UserHandler) RegisterUser(w http.ResponseWriter, r *http.Request) {
 	var req registerUserRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.logger.Printf("ERROR: invalid body: %v", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "invalid request body"})
+		problem.Write(w, r, problem.InvalidBody, "invalid request body")
 		return
 	}
 
-	if err := h.validateRegisterUserRequest(&req); err != nil {
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": err.Error()})
+	v := validator.New()
+	if validateRegisterUserRequest(v, &req); !v.Valid() {
+		problem.WriteValidation(w, r, v.Errors)
 		return
 	}
 
 	existing, err := h.userStore.GetByUsername(req.Username)
 	if err != nil {
 		h.logger.Printf("ERROR: checking existing user: %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		problem.ServerError(w, r)
 		return
 	}
 	if existing != nil {
-		utils.WriteJSON(w, http.StatusConflict, utils.Envelope{"error": "username already taken"})
+		problem.Write(w, r, problem.DuplicateUsername, "username already taken")
 		return
 	}
 
@@ -87,21 +90,413 @@ func (h *UserHandler) RegisterUser(w http.ResponseWriter, r *http.Request) {
 		Username: req.Username,
 		Email:    req.Email,
 		Bio:      req.Bio,
+		Units:    req.Units,
 	}
 
 	err = user.PasswordHash.Set(req.Password)
 	if err != nil {
 		h.logger.Printf("ERROR: setting password hash: %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		problem.ServerError(w, r)
 		return
 	}
 
 	created, err := h.userStore.Create(user)
 	if err != nil {
+		if errors.Is(err, store.ErrDuplicateEmail) {
+			problem.Write(w, r, problem.DuplicateEmail, err.Error())
+			return
+		}
+		if errors.Is(err, store.ErrDuplicateUsername) {
+			problem.Write(w, r, problem.DuplicateUsername, err.Error())
+			return
+		}
 		h.logger.Printf("ERROR: creating user: %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		problem.ServerError(w, r)
 		return
 	}
 
+	// the account is usable right away, so a failed email only gets logged
+	if err = h.sendActivation(created); err != nil {
+		h.logger.Printf("ERROR: sending activation email: %v", err)
+	}
+
 	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": created})
 }
+
+func (h *UserHandler) sendActivation(user *store.User) error {
+	err := h.tokenStore.DeleteForUser(user.ID, tokens.ScopeActivation)
+	if err != nil {
+		return err
+	}
+
+	token, err := h.tokenStore.Create(user.ID, activationTTL, tokens.ScopeActivation)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/activate?token=%s", h.appURL, url.QueryEscape(token.PlainText))
+	body := fmt.Sprintf("Hi %s,\n\nConfirm your email address by opening the link below. It expires in %d hours.\n\n%s",
+		user.Username, int(activationTTL.Hours()), link)
+
+	return h.mailer.Send(user.Email, "Confirm your email address", body)
+}
+
+type activateUserRequest struct {
+	Token string `json:"token"`
+}
+
+func (h *UserHandler) Activate(w http.ResponseWriter, r *http.Request) {
+	var req activateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Printf("ERROR: invalid body: %v", err)
+		problem.Write(w, r, problem.InvalidBody, "invalid request body")
+		return
+	}
+
+	user, err := h.userStore.GetUserToken(tokens.ScopeActivation, req.Token)
+	if err != nil {
+		h.logger.Printf("ERROR: get activation token: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	if user == nil {
+		problem.Write(w, r, problem.BadRequest, "invalid or expired activation token")
+		return
+	}
+
+	now := time.Now()
+	user.EmailVerifiedAt = &now
+	updated, err := h.userStore.Update(user)
+	if err != nil {
+		h.logger.Printf("ERROR: activating user: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	if updated == nil {
+		problem.Write(w, r, problem.NotFound, "user not found")
+		return
+	}
+
+	err = h.tokenStore.DeleteForUser(user.ID, tokens.ScopeActivation)
+	if err != nil {
+		h.logger.Printf("ERROR: delete activation tokens: %v", err)
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": updated})
+}
+
+func (h *UserHandler) GetMe(w http.ResponseWriter, r *http.Request) {
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": middleware.GetUser(r)})
+}
+
+type updateUserRequest struct {
+	Username *string `json:"username"`
+	Email    *string `json:"email"`
+	Bio      *string `json:"bio"`
+	Units    *string `json:"units"`
+	// CurrentPassword is required to change the email, which is enough to
+	// reset the password and take over the account.
+	CurrentPassword string `json:"current_password"`
+}
+
+func (h *UserHandler) UpdateMe(w http.ResponseWriter, r *http.Request) {
+	var req updateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Printf("ERROR: invalid body: %v", err)
+		problem.Write(w, r, problem.InvalidBody, "invalid request body")
+		return
+	}
+
+	user := *middleware.GetUser(r)
+
+	v := validator.New()
+	if req.Username != nil {
+		validateUsername(v, *req.Username)
+	}
+	if req.Email != nil {
+		validateEmail(v, *req.Email)
+	}
+	if req.Units != nil {
+		validateUnits(v, *req.Units)
+	}
+	if !v.Valid() {
+		problem.WriteValidation(w, r, v.Errors)
+		return
+	}
+
+	emailChanged := req.Email != nil && *req.Email != user.Email
+	if emailChanged {
+		if req.CurrentPassword == "" {
+			problem.WriteValidation(w, r, map[string]string{"current_password": "current_password is required to change the email"})
+			return
+		}
+
+		doesPasswordMatch, err := user.PasswordHash.Check(req.CurrentPassword)
+		if err != nil {
+			h.logger.Printf("ERROR: check password: %v", err)
+			problem.ServerError(w, r)
+			return
+		}
+
+		if !doesPasswordMatch {
+			problem.Write(w, r, problem.InvalidCredentials, "current password is incorrect")
+			return
+		}
+	}
+
+	if req.Username != nil {
+		user.Username = *req.Username
+	}
+	if emailChanged {
+		user.Email = *req.Email
+		user.EmailVerifiedAt = nil
+	}
+	if req.Bio != nil {
+		user.Bio = *req.Bio
+	}
+	if req.Units != nil {
+		user.Units = *req.Units
+	}
+
+	updated, err := h.userStore.Update(&user)
+	if err != nil {
+		if errors.Is(err, store.ErrDuplicateEmail) {
+			problem.Write(w, r, problem.DuplicateEmail, err.Error())
+			return
+		}
+		if errors.Is(err, store.ErrDuplicateUsername) {
+			problem.Write(w, r, problem.DuplicateUsername, err.Error())
+			return
+		}
+		h.logger.Printf("ERROR: updating user: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	if updated == nil {
+		problem.Write(w, r, problem.NotFound, "user not found")
+		return
+	}
+
+	if emailChanged {
+		if err = h.sendActivation(updated); err != nil {
+			h.logger.Printf("ERROR: sending activation email: %v", err)
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": updated})
+}
+
+type deleteUserRequest struct {
+	Password string `json:"password"`
+}
+
+func (h *UserHandler) DeleteMe(w http.ResponseWriter, r *http.Request) {
+	var req deleteUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Printf("ERROR: invalid body: %v", err)
+		problem.Write(w, r, problem.InvalidBody, "invalid request body")
+		return
+	}
+
+	user := middleware.GetUser(r)
+	doesPasswordMatch, err := user.PasswordHash.Check(req.Password)
+	if err != nil {
+		h.logger.Printf("ERROR: check password: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	if !doesPasswordMatch {
+		problem.Write(w, r, problem.InvalidCredentials, "password is incorrect")
+		return
+	}
+
+	err = h.userStore.Delete(user.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			problem.Write(w, r, problem.NotFound, "user not found")
+			return
+		}
+		h.logger.Printf("ERROR: deleting user: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+func (h *UserHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	var req changePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Printf("ERROR: invalid body: %v", err)
+		problem.Write(w, r, problem.InvalidBody, "invalid request body")
+		return
+	}
+
+	user := *middleware.GetUser(r)
+
+	doesPasswordMatch, err := user.PasswordHash.Check(req.CurrentPassword)
+	if err != nil {
+		h.logger.Printf("ERROR: check password: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	if !doesPasswordMatch {
+		problem.Write(w, r, problem.InvalidCredentials, "current password is incorrect")
+		return
+	}
+
+	v := validator.New()
+	if validatePassword(v, "new_password", req.NewPassword); !v.Valid() {
+		problem.WriteValidation(w, r, v.Errors)
+		return
+	}
+
+	if !h.setPassword(w, r, &user, req.NewPassword) {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+type forgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+func (h *UserHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req forgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Printf("ERROR: invalid body: %v", err)
+		problem.Write(w, r, problem.InvalidBody, "invalid request body")
+		return
+	}
+
+	v := validator.New()
+	if validateEmail(v, req.Email); !v.Valid() {
+		problem.WriteValidation(w, r, v.Errors)
+		return
+	}
+
+	// the response is the same whether or not the email is registered, so
+	// this endpoint can't be used to discover accounts
+	accepted := utils.Envelope{"message": "if the email is registered, a password reset link has been sent"}
+
+	user, err := h.userStore.GetByEmail(req.Email)
+	if err != nil {
+		h.logger.Printf("ERROR: get user by email: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	if user == nil {
+		utils.WriteJSON(w, http.StatusAccepted, accepted)
+		return
+	}
+
+	err = h.tokenStore.DeleteForUser(user.ID, tokens.ScopePasswordReset)
+	if err != nil {
+		h.logger.Printf("ERROR: delete password reset tokens: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	token, err := h.tokenStore.Create(user.ID, passwordResetTTL, tokens.ScopePasswordReset)
+	if err != nil {
+		h.logger.Printf("ERROR: create password reset token: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", h.appURL, url.QueryEscape(token.PlainText))
+	body := fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password. It expires in %d minutes.\n\n%s\n\nIf you didn't ask for a password reset, you can ignore this email.",
+		user.Username, int(passwordResetTTL.Minutes()), link)
+
+	err = h.mailer.Send(user.Email, "Reset your password", body)
+	if err != nil {
+		h.logger.Printf("ERROR: send password reset email: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusAccepted, accepted)
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func (h *UserHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req resetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Printf("ERROR: invalid body: %v", err)
+		problem.Write(w, r, problem.InvalidBody, "invalid request body")
+		return
+	}
+
+	v := validator.New()
+	if validatePassword(v, "password", req.Password); !v.Valid() {
+		problem.WriteValidation(w, r, v.Errors)
+		return
+	}
+
+	user, err := h.userStore.GetUserToken(tokens.ScopePasswordReset, req.Token)
+	if err != nil {
+		h.logger.Printf("ERROR: get password reset token: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	if user == nil {
+		problem.Write(w, r, problem.BadRequest, "invalid or expired password reset token")
+		return
+	}
+
+	if !h.setPassword(w, r, user, req.Password) {
+		return
+	}
+
+	// a reset means the old password may be compromised, so every session goes
+	for _, scope := range []string{tokens.ScopePasswordReset, tokens.ScopeAuth, tokens.ScopeRefresh} {
+		err = h.tokenStore.DeleteForUser(user.ID, scope)
+		if err != nil {
+			h.logger.Printf("ERROR: delete tokens for user: %v", err)
+			problem.ServerError(w, r)
+			return
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+func (h *UserHandler) setPassword(w http.ResponseWriter, r *http.Request, user *store.User, plainText string) bool {
+	err := user.PasswordHash.Set(plainText)
+	if err != nil {
+		h.logger.Printf("ERROR: setting password hash: %v", err)
+		problem.ServerError(w, r)
+		return false
+	}
+
+	updated, err := h.userStore.Update(user)
+	if err != nil {
+		h.logger.Printf("ERROR: updating user password: %v", err)
+		problem.ServerError(w, r)
+		return false
+	}
+
+	if updated == nil {
+		problem.Write(w, r, problem.NotFound, "user not found")
+		return false
+	}
+
+	return true
+}
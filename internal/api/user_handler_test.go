@@ -0,0 +1,77 @@
+package api
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joao-vitor-felix/workout-api/internal/mailer"
+	"github.com/joao-vitor-felix/workout-api/internal/middleware"
+	"github.com/joao-vitor-felix/workout-api/internal/store"
+	"github.com/joao-vitor-felix/workout-api/internal/tokens"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubUserStore records the user it was asked to update.
+type stubUserStore struct {
+	store.UserStore
+	updated *store.User
+}
+
+func (s *stubUserStore) Update(user *store.User) (*store.User, error) {
+	s.updated = user
+	return user, nil
+}
+
+// stubTokenStore hands out activation tokens without storing them.
+type stubTokenStore struct {
+	store.TokenStore
+}
+
+func (s *stubTokenStore) DeleteForUser(userId int, scope string) error {
+	return nil
+}
+
+func (s *stubTokenStore) Create(userId int, ttl time.Duration, scope string) (*tokens.Token, error) {
+	return &tokens.Token{PlainText: "token"}, nil
+}
+
+func TestUpdateMeEmail(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"email without the password", `{"email": "new@example.com"}`, http.StatusUnprocessableEntity},
+		{"email with a wrong password", `{"email": "new@example.com", "current_password": "wrong password"}`, http.StatusUnauthorized},
+		{"email with the password", `{"email": "new@example.com", "current_password": "password"}`, http.StatusOK},
+		{"same email without the password", `{"email": "owner@example.com", "bio": "Lifter"}`, http.StatusOK},
+		{"other fields without the password", `{"bio": "Lifter"}`, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := &store.User{ID: 1, Username: "owner", Email: "owner@example.com"}
+			require.NoError(t, user.PasswordHash.Set("password"))
+
+			logger := log.New(io.Discard, "", 0)
+			userStore := &stubUserStore{}
+			handler := NewUserHandler(userStore, &stubTokenStore{}, nil, mailer.NewLogMailer(logger), "http://localhost", logger)
+
+			w := httptest.NewRecorder()
+			r := middleware.SetUser(httptest.NewRequest(http.MethodPatch, "/users/me", strings.NewReader(tt.body)), user)
+
+			handler.UpdateMe(w, r)
+
+			assert.Equal(t, tt.status, w.Code)
+			if tt.status != http.StatusOK {
+				assert.Nil(t, userStore.updated)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/joao-vitor-felix/workout-api/internal/store"
+	"github.com/joao-vitor-felix/workout-api/internal/units"
+	"github.com/joao-vitor-felix/workout-api/internal/validator"
+)
+
+// Entries are validated after their weights and distances are converted to
+// kilograms and meters.
+const (
+	maxEntryWeight   = 2000
+	maxEntryDistance = 1000000
+	maxEntrySets     = 100
+	maxGroupRounds   = 100
+)
+
+var exerciseTypes = []string{store.ExerciseTypeReps, store.ExerciseTypeTime}
+
+func validateUsername(v *validator.Validator, username string) {
+	v.Check(username != "", "username", "username is required")
+	v.Check(validator.MinChars(username, 3), "username", "username must be at least 3 characters long")
+	v.Check(validator.MaxChars(username, 20), "username", "username must not exceed 20 characters")
+}
+
+func validateEmail(v *validator.Validator, email string) {
+	v.Check(email != "", "email", "email is required")
+	v.Check(validator.MaxChars(email, 255), "email", "email must not exceed 255 characters")
+	v.Check(validator.Matches(email, validator.EmailRX), "email", "invalid email format")
+}
+
+func validateUnits(v *validator.Validator, system string) {
+	v.Check(units.IsValid(system), "units", "units must be one of metric or imperial")
+}
+
+func validatePassword(v *validator.Validator, field, password string) {
+	v.Check(password != "", field, field+" is required")
+	v.Check(validator.MinChars(password, 6), field, field+" must be at least 6 characters long")
+}
+
+func validateWorkout(v *validator.Validator, workout *store.Workout) {
+	v.Check(validator.NotBlank(workout.Title), "title", "title is required")
+	v.Check(validator.MaxChars(workout.Title, 100), "title", "title must not exceed 100 characters")
+	v.Check(workout.DurationMinutes >= 0, "duration_minutes", "duration_minutes must not be negative")
+	v.Check(workout.CaloriesBurned >= 0, "calories_burned", "calories_burned must not be negative")
+	v.Check(store.IsValidVisibility(workout.Visibility), "visibility", "visibility must be one of private, followers or public")
+
+	for i := range workout.Entries {
+		validateEntry(v, fmt.Sprintf("entries[%d].", i), &workout.Entries[i])
+	}
+
+	validateEntryGroups(v, workout)
+}
+
+// validateEntryGroups checks the groups of a workout and that the members of
+// each group follow one another in order_index.
+func validateEntryGroups(v *validator.Validator, workout *store.Workout) {
+	labels := make(map[string]bool, len(workout.Groups))
+	for i, group := range workout.Groups {
+		prefix := fmt.Sprintf("groups[%d].", i)
+		v.Check(validator.NotBlank(group.Label), prefix+"label", "label is required")
+		v.Check(validator.MaxChars(group.Label, 10), prefix+"label", "label must not exceed 10 characters")
+		v.Check(!labels[group.Label], prefix+"label", "label must be unique within the workout")
+		v.Check(store.IsValidGroupType(group.Type), prefix+"type", "type must be one of superset, circuit, emom or amrap")
+		v.Check(group.Rounds >= 0 && group.Rounds <= maxGroupRounds, prefix+"rounds", fmt.Sprintf("rounds must be between 1 and %d, or 0 for the default of 1", maxGroupRounds))
+		labels[group.Label] = true
+	}
+
+	// entries are stored in order_index order, keeping the given order for ties
+	order := make([]int, len(workout.Entries))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return workout.Entries[order[a]].OrderIndex < workout.Entries[order[b]].OrderIndex
+	})
+
+	closed := map[string]bool{}
+	var current string
+	for _, i := range order {
+		entry := workout.Entries[i]
+		label := ""
+		if entry.Group != nil {
+			label = *entry.Group
+		}
+
+		if label != current {
+			closed[current] = true
+			current = label
+		}
+		if label == "" {
+			continue
+		}
+
+		field := fmt.Sprintf("entries[%d].group", i)
+		if !labels[label] {
+			v.AddError(field, "group must be the label of one of the workout's groups")
+			continue
+		}
+		v.Check(!closed[label], field, "entries of a group must be next to each other in order_index")
+	}
+}
+
+// validateEntry checks an entry, reporting problems under prefix followed by
+// the field name so entries of a workout can be told apart.
+func validateEntry(v *validator.Validator, prefix string, entry *store.WorkoutEntry) {
+	v.Check(entry.ExerciseID != nil || validator.NotBlank(entry.ExerciseName), prefix+"exercise_name", "exercise_name or exercise_id is required")
+	v.Check(validator.MaxChars(entry.ExerciseName, 255), prefix+"exercise_name", "exercise_name must not exceed 255 characters")
+	v.Check(entry.OrderIndex >= 0, prefix+"order_index", "order_index must not be negative")
+
+	if len(entry.SetDetails) > 0 {
+		v.Check(len(entry.SetDetails) <= maxEntrySets, prefix+"set_details", fmt.Sprintf("an entry must not have more than %d sets", maxEntrySets))
+		for i := range entry.SetDetails {
+			validateSet(v, fmt.Sprintf("%sset_details[%d].", prefix, i), &entry.SetDetails[i])
+		}
+
+		// the aggregate fields are derived from the sets, but entries read back
+		// carry both shapes and an edited aggregate may replace the sets
+		if entry.Sets == 0 && entry.Reps == nil && entry.DurationSeconds == nil && entry.Weight == nil && entry.Distance == nil {
+			return
+		}
+	}
+
+	v.Check(entry.Sets > 0, prefix+"sets", "sets must be greater than zero")
+	v.Check(entry.Sets <= maxEntrySets, prefix+"sets", fmt.Sprintf("sets must not exceed %d", maxEntrySets))
+
+	switch {
+	case entry.Reps == nil && entry.DurationSeconds == nil:
+		v.AddError(prefix+"reps", "either reps or duration_seconds is required")
+	case entry.Reps != nil && entry.DurationSeconds != nil:
+		v.AddError(prefix+"reps", "reps and duration_seconds can't both be set")
+	case entry.Reps != nil:
+		v.Check(*entry.Reps > 0, prefix+"reps", "reps must be greater than zero")
+	default:
+		v.Check(*entry.DurationSeconds > 0, prefix+"duration_seconds", "duration_seconds must be greater than zero")
+	}
+
+	validateLoad(v, prefix, entry.Weight, entry.Distance)
+}
+
+// validateLoad checks the weight and distance of an entry or a set. Limits
+// are given in both unit systems since the values may have been sent in
+// either.
+func validateLoad(v *validator.Validator, prefix string, weight, distance *float64) {
+	if weight != nil {
+		v.Check(*weight >= 0, prefix+"weight", "weight must not be negative")
+		v.Check(*weight <= maxEntryWeight, prefix+"weight", fmt.Sprintf("weight must not exceed %g kg (%g lb)",
+			float64(maxEntryWeight), units.FromKilograms(maxEntryWeight, units.Imperial)))
+	}
+	if distance != nil {
+		v.Check(*distance >= 0, prefix+"distance", "distance must not be negative")
+		v.Check(*distance <= maxEntryDistance, prefix+"distance", fmt.Sprintf("distance must not exceed %g km (%g mi)",
+			units.FromMeters(maxEntryDistance, units.Metric), units.FromMeters(maxEntryDistance, units.Imperial)))
+	}
+}
+
+func validateSet(v *validator.Validator, prefix string, set *store.WorkoutSet) {
+	v.Check(set.Type == "" || store.IsValidSetType(set.Type), prefix+"type", "type must be one of warmup, working, drop or failure")
+
+	switch {
+	case set.Reps == nil && set.DurationSeconds == nil:
+		v.AddError(prefix+"reps", "either reps or duration_seconds is required")
+	case set.Reps != nil && set.DurationSeconds != nil:
+		v.AddError(prefix+"reps", "reps and duration_seconds can't both be set")
+	case set.Reps != nil:
+		// a failed set may end without a single rep
+		v.Check(*set.Reps >= 0, prefix+"reps", "reps must not be negative")
+	default:
+		v.Check(*set.DurationSeconds > 0, prefix+"duration_seconds", "duration_seconds must be greater than zero")
+	}
+
+	validateLoad(v, prefix, set.Weight, set.Distance)
+	if set.RPE != nil {
+		v.Check(*set.RPE >= 1 && *set.RPE <= 10, prefix+"rpe", "rpe must be between 1 and 10")
+	}
+	if set.RIR != nil {
+		v.Check(*set.RIR >= 0, prefix+"rir", "rir must not be negative")
+	}
+}
+
+func validateExercise(v *validator.Validator, exercise *store.Exercise) {
+	v.Check(validator.NotBlank(exercise.Name), "name", "name is required")
+	v.Check(validator.MaxChars(exercise.Name, 255), "name", "name must not exceed 255 characters")
+	v.Check(validator.PermittedValue(exercise.Type, exerciseTypes...), "type", "type must be one of reps or time")
+
+	for field, values := range map[string][]string{
+		"aliases":       exercise.Aliases,
+		"muscle_groups": exercise.MuscleGroups,
+		"equipment":     exercise.Equipment,
+	} {
+		for _, value := range values {
+			v.Check(validator.NotBlank(value), field, field+" must not contain blank values")
+			v.Check(validator.MaxChars(value, 100), field, field+" values must not exceed 100 characters")
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"slices"
+
+	"github.com/joao-vitor-felix/workout-api/internal/jsonpatch"
+	"github.com/joao-vitor-felix/workout-api/internal/middleware"
+	"github.com/joao-vitor-felix/workout-api/internal/problem"
+	"github.com/joao-vitor-felix/workout-api/internal/store"
+	"github.com/joao-vitor-felix/workout-api/internal/utils"
+	"github.com/joao-vitor-felix/workout-api/internal/validator"
+)
+
+// ownedWorkout loads the workout in the URL for a change by its owner, along
+// with the unit system of the request. When it returns nil the response has
+// already been written.
+func (wh *WorkoutHandler) ownedWorkout(w http.ResponseWriter, r *http.Request) (*store.Workout, string) {
+	workoutId, err := utils.ReadIdParam(r)
+	if err != nil {
+		problem.Write(w, r, problem.InvalidParameter, "invalid workout ID")
+		return nil, ""
+	}
+
+	workout, err := wh.store.GetByID(workoutId)
+	if err != nil {
+		wh.logger.Printf("ERROR: get workout: %v", err)
+		problem.ServerError(w, r)
+		return nil, ""
+	}
+
+	if workout == nil {
+		problem.Write(w, r, problem.NotFound, "workout not found")
+		return nil, ""
+	}
+
+	currentUser := middleware.GetUser(r)
+	if workout.UserID != currentUser.ID {
+		wh.writeNotOwner(w, r, workout, currentUser)
+		return nil, ""
+	}
+
+	system, ok := requestUnits(w, r)
+	if !ok {
+		return nil, ""
+	}
+
+	if !checkIfMatch(w, r, workout, system) {
+		return nil, ""
+	}
+
+	return workout, system
+}
+
+// entryIndex finds the entry in the URL within workout, answering 404 when
+// it belongs to some other workout.
+func entryIndex(w http.ResponseWriter, r *http.Request, workout *store.Workout) (int, bool) {
+	entryId, err := utils.ReadIntParam(r, "entryId")
+	if err != nil {
+		problem.Write(w, r, problem.InvalidParameter, "invalid entry ID")
+		return 0, false
+	}
+
+	index := slices.IndexFunc(workout.Entries, func(entry store.WorkoutEntry) bool {
+		return int64(entry.ID) == entryId
+	})
+	if index < 0 {
+		problem.Write(w, r, problem.NotFound, "entry not found")
+		return 0, false
+	}
+
+	return index, true
+}
+
+// moveEntry moves the entry at from so that it ends up at the 1-based
+// position, or last when position is outside the list, and renumbers
+// order_index to match. It returns where the entry ended up.
+func moveEntry(entries []store.WorkoutEntry, from, position int) ([]store.WorkoutEntry, int) {
+	entry := entries[from]
+	entries = slices.Delete(entries, from, from+1)
+
+	to := position - 1
+	if to < 0 || to > len(entries) {
+		to = len(entries)
+	}
+	entries = slices.Insert(entries, to, entry)
+
+	for i := range entries {
+		entries[i].OrderIndex = i + 1
+	}
+	return entries, to
+}
+
+func (wh *WorkoutHandler) saveEntryChange(w http.ResponseWriter, r *http.Request, workout *store.Workout, system string) bool {
+	// moving an entry can split a group apart
+	v := validator.New()
+	if validateEntryGroups(v, workout); !v.Valid() {
+		problem.WriteValidation(w, r, v.Errors)
+		return false
+	}
+
+	err := wh.store.Update(workout)
+	if err != nil {
+		wh.writeUpdateError(w, r, err)
+		return false
+	}
+
+	w.Header().Set("ETag", workoutETag(workout, system))
+	return true
+}
+
+// CreateEntry adds one entry to a workout. It goes at order_index when that
+// is a position within the list and at the end otherwise.
+func (wh *WorkoutHandler) CreateEntry(w http.ResponseWriter, r *http.Request) {
+	workout, system := wh.ownedWorkout(w, r)
+	if workout == nil {
+		return
+	}
+
+	var entry store.WorkoutEntry
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&entry)
+	if err != nil {
+		problem.Write(w, r, problem.InvalidBody, "invalid request body")
+		return
+	}
+	canonicalizeEntry(&entry, nil, system)
+
+	v := validator.New()
+	if validateEntry(v, "", &entry); !v.Valid() {
+		problem.WriteValidation(w, r, v.Errors)
+		return
+	}
+
+	entry.ID = 0
+	var index int
+	workout.Entries, index = moveEntry(append(workout.Entries, entry), len(workout.Entries), entry.OrderIndex)
+
+	if !wh.saveEntryChange(w, r, workout, system) {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{"data": localizeEntry(workout.Entries[index], system)})
+}
+
+// UpdateEntry changes one entry with merge patch semantics: fields left out
+// are kept and null clears them. Changing order_index moves the entry.
+func (wh *WorkoutHandler) UpdateEntry(w http.ResponseWriter, r *http.Request) {
+	workout, system := wh.ownedWorkout(w, r)
+	if workout == nil {
+		return
+	}
+
+	index, ok := entryIndex(w, r, workout)
+	if !ok {
+		return
+	}
+
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPatchBodySize))
+	if err != nil {
+		problem.Write(w, r, problem.PayloadTooLarge, "request body too large")
+		return
+	}
+
+	// the patch is written against the entry as the client sees it
+	current := workout.Entries[index]
+	doc, err := json.Marshal(localizeEntry(current, system))
+	if err != nil {
+		wh.logger.Printf("ERROR: encode workout entry: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	patched, err := jsonpatch.MergePatch(doc, patch)
+	if err != nil {
+		if errors.Is(err, jsonpatch.ErrInvalidPatch) {
+			problem.Write(w, r, problem.InvalidBody, "invalid request body")
+			return
+		}
+		wh.logger.Printf("ERROR: apply entry patch: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	var entry store.WorkoutEntry
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&entry)
+	if err != nil {
+		problem.Write(w, r, problem.Unprocessable, "patched entry is invalid: "+err.Error())
+		return
+	}
+	canonicalizeEntry(&entry, &workout.Entries[index], system)
+
+	v := validator.New()
+	if validateEntry(v, "", &entry); !v.Valid() {
+		problem.WriteValidation(w, r, v.Errors)
+		return
+	}
+
+	entry.ID = current.ID
+	workout.Entries[index] = entry
+	workout.Entries, index = moveEntry(workout.Entries, index, entry.OrderIndex)
+
+	if !wh.saveEntryChange(w, r, workout, system) {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": localizeEntry(workout.Entries[index], system)})
+}
+
+func (wh *WorkoutHandler) DeleteEntry(w http.ResponseWriter, r *http.Request) {
+	workout, system := wh.ownedWorkout(w, r)
+	if workout == nil {
+		return
+	}
+
+	index, ok := entryIndex(w, r, workout)
+	if !ok {
+		return
+	}
+
+	workout.Entries = slices.Delete(workout.Entries, index, index+1)
+	for i := range workout.Entries {
+		workout.Entries[i].OrderIndex = i + 1
+	}
+
+	if !wh.saveEntryChange(w, r, workout, system) {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusNoContent, nil)
+}
+
+// ReorderEntries puts a workout's entries in the order of entry_ids, which
+// must list every entry exactly once.
+func (wh *WorkoutHandler) ReorderEntries(w http.ResponseWriter, r *http.Request) {
+	workout, system := wh.ownedWorkout(w, r)
+	if workout == nil {
+		return
+	}
+
+	var req struct {
+		EntryIDs []int `json:"entry_ids"`
+	}
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		problem.Write(w, r, problem.InvalidBody, "invalid request body")
+		return
+	}
+
+	byID := make(map[int]store.WorkoutEntry, len(workout.Entries))
+	for _, entry := range workout.Entries {
+		byID[entry.ID] = entry
+	}
+
+	if len(req.EntryIDs) != len(workout.Entries) {
+		problem.Write(w, r, problem.Unprocessable, "entry_ids must list every entry of the workout exactly once")
+		return
+	}
+
+	entries := make([]store.WorkoutEntry, 0, len(req.EntryIDs))
+	for i, id := range req.EntryIDs {
+		entry, ok := byID[id]
+		if !ok {
+			problem.Write(w, r, problem.Unprocessable, "entry_ids must list every entry of the workout exactly once")
+			return
+		}
+		delete(byID, id)
+
+		entry.OrderIndex = i + 1
+		entries = append(entries, entry)
+	}
+	workout.Entries = entries
+
+	if !wh.saveEntryChange(w, r, workout, system) {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": localizeWorkout(workout, system)})
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/joao-vitor-felix/workout-api/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMoveEntry(t *testing.T) {
+	entries := func(names ...string) []store.WorkoutEntry {
+		list := make([]store.WorkoutEntry, len(names))
+		for i, name := range names {
+			list[i] = store.WorkoutEntry{ExerciseName: name, OrderIndex: i + 1}
+		}
+		return list
+	}
+
+	tests := []struct {
+		name     string
+		entries  []store.WorkoutEntry
+		from     int
+		position int
+		want     []string
+		wantAt   int
+	}{
+		{
+			name:     "new entry inserted at a position",
+			entries:  entries("squat", "bench", "row", "curl"),
+			from:     3,
+			position: 2,
+			want:     []string{"squat", "curl", "bench", "row"},
+			wantAt:   1,
+		},
+		{
+			name:     "position 0 goes last",
+			entries:  entries("squat", "bench", "row"),
+			from:     0,
+			position: 0,
+			want:     []string{"bench", "row", "squat"},
+			wantAt:   2,
+		},
+		{
+			name:     "position past the end goes last",
+			entries:  entries("squat", "bench", "row"),
+			from:     1,
+			position: 10,
+			want:     []string{"squat", "row", "bench"},
+			wantAt:   2,
+		},
+		{
+			name:     "moving up",
+			entries:  entries("squat", "bench", "row", "curl"),
+			from:     2,
+			position: 1,
+			want:     []string{"row", "squat", "bench", "curl"},
+			wantAt:   0,
+		},
+		{
+			name:     "moving down",
+			entries:  entries("squat", "bench", "row", "curl"),
+			from:     0,
+			position: 3,
+			want:     []string{"bench", "row", "squat", "curl"},
+			wantAt:   2,
+		},
+		{
+			name:     "staying in place",
+			entries:  entries("squat", "bench"),
+			from:     1,
+			position: 2,
+			want:     []string{"squat", "bench"},
+			wantAt:   1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			moved, at := moveEntry(tt.entries, tt.from, tt.position)
+
+			names := make([]string, len(moved))
+			for i, entry := range moved {
+				names[i] = entry.ExerciseName
+				assert.Equal(t, i+1, entry.OrderIndex)
+			}
+			assert.Equal(t, tt.want, names)
+			assert.Equal(t, tt.wantAt, at)
+		})
+	}
+}
+
+func TestCreateEntryUnknownField(t *testing.T) {
+	workoutStore := &stubWorkoutStore{
+		workout: &store.Workout{ID: 7, UserID: 1, Title: "Push day", Visibility: store.VisibilityPrivate, Version: 1},
+	}
+	handler := NewWorkoutHandler(workoutStore, nil, "", nil)
+
+	w := httptest.NewRecorder()
+	body := strings.NewReader(`{"exercise_name": "Bench press", "sets": 3, "reps": 5, "weigth": 80}`)
+	r := newWorkoutRequest(http.MethodPost, "/workouts/7/entries", body, &store.User{ID: 1}, map[string]string{"id": "7"})
+
+	handler.CreateEntry(w, r)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Nil(t, workoutStore.updated)
+}
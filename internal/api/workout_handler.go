@@ -2,89 +2,328 @@ package api
 
 import (
 	"database/sql"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joao-vitor-felix/workout-api/internal/middleware"
+	"github.com/joao-vitor-felix/workout-api/internal/problem"
 	"github.com/joao-vitor-felix/workout-api/internal/store"
+	"github.com/joao-vitor-felix/workout-api/internal/units"
 	"github.com/joao-vitor-felix/workout-api/internal/utils"
+	"github.com/joao-vitor-felix/workout-api/internal/validator"
 )
 
 type WorkoutHandler struct {
-	store  store.WorkoutStore
-	logger *log.Logger
+	store            store.WorkoutStore
+	followStore      store.FollowStore
+	unverifiedPolicy string
+	logger           *log.Logger
 }
 
-func NewWorkoutHandler(store store.WorkoutStore, logger *log.Logger) *WorkoutHandler {
+func NewWorkoutHandler(store store.WorkoutStore, followStore store.FollowStore, unverifiedPolicy string, logger *log.Logger) *WorkoutHandler {
 	return &WorkoutHandler{
 		store,
+		followStore,
+		unverifiedPolicy,
 		logger,
 	}
 }
 
+func (wh *WorkoutHandler) canView(workout *store.Workout, user *store.User) (bool, error) {
+	if !user.IsAnonymous() && workout.UserID == user.ID {
+		return true, nil
+	}
+
+	switch workout.Visibility {
+	case store.VisibilityPublic:
+		return true, nil
+	case store.VisibilityFollowers:
+		if user.IsAnonymous() {
+			return false, nil
+		}
+		return wh.followStore.IsFollowing(user.ID, workout.UserID)
+	default:
+		return false, nil
+	}
+}
+
 func (wh *WorkoutHandler) GetById(w http.ResponseWriter, r *http.Request) {
 	workoutId, err := utils.ReadIdParam(r)
 	if err != nil {
 		wh.logger.Printf("ERROR: reading workout ID: %v", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
-			"error": "Invalid workout ID",
-		})
+		problem.Write(w, r, problem.InvalidParameter, "invalid workout ID")
+		return
+	}
+
+	system, ok := requestUnits(w, r)
+	if !ok {
 		return
 	}
 
 	workout, err := wh.store.GetByID(workoutId)
 	if err != nil {
 		wh.logger.Printf("ERROR: get workout by ID: %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
-			"error": "internal server error",
-		})
+		problem.ServerError(w, r)
 		return
 	}
 
 	if workout == nil {
-		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{
-			"error": "not found",
-		})
+		problem.Write(w, r, problem.NotFound, "workout not found")
+		return
+	}
+
+	visible, err := wh.canView(workout, middleware.GetUser(r))
+	if err != nil {
+		wh.logger.Printf("ERROR: check workout visibility: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	// hidden workouts are reported as missing so their IDs don't leak
+	if !visible {
+		problem.Write(w, r, problem.NotFound, "workout not found")
+		return
+	}
+
+	w.Header().Set("ETag", workoutETag(workout, system))
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"data": localizeWorkout(workout, system),
+	})
+}
+
+// workoutETag tells apart the versions of a workout and the unit systems it
+// is shown in, since the same version reads differently in each.
+func workoutETag(workout *store.Workout, system string) string {
+	return fmt.Sprintf(`"%d-%s"`, workout.Version, system)
+}
+
+// checkIfMatch answers 412 and returns false when the request carries an
+// If-Match header that doesn't match the workout's current ETag. Changes are
+// made to the stored workout, so an ETag read in either unit system matches.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, workout *store.Workout, system string) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == workoutETag(workout, units.Metric) || candidate == workoutETag(workout, units.Imperial) {
+			return true
+		}
+	}
+
+	w.Header().Set("ETag", workoutETag(workout, system))
+	problem.Write(w, r, problem.PreconditionFailed, "workout has been modified")
+	return false
+}
+
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
+func (wh *WorkoutHandler) List(w http.ResponseWriter, r *http.Request) {
+	wh.list(w, r, false)
+}
+
+func (wh *WorkoutHandler) ListTrash(w http.ResponseWriter, r *http.Request) {
+	wh.list(w, r, true)
+}
+
+func (wh *WorkoutHandler) list(w http.ResponseWriter, r *http.Request, trashed bool) {
+	filter, err := readWorkoutFilter(r)
+	if err != nil {
+		problem.Write(w, r, problem.InvalidParameter, err.Error())
+		return
+	}
+	filter.Trashed = trashed
+
+	system, ok := requestUnits(w, r)
+	if !ok {
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+
+	workouts, next, err := wh.store.ListByUser(currentUser.ID, filter)
+	if err != nil {
+		wh.logger.Printf("ERROR: list workouts: %v", err)
+		problem.ServerError(w, r)
 		return
 	}
 
+	var nextCursor *string
+	if next != nil {
+		encoded := encodeWorkoutCursor(next)
+		nextCursor = &encoded
+	}
+
 	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
-		"data": workout,
+		"data":        localizeWorkouts(workouts, system),
+		"next_cursor": nextCursor,
 	})
 }
 
+func readWorkoutFilter(r *http.Request) (store.WorkoutFilter, error) {
+	query := r.URL.Query()
+	filter := store.WorkoutFilter{
+		Title: strings.TrimSpace(query.Get("title")),
+		Limit: defaultListLimit,
+	}
+
+	var err error
+	if filter.Limit, err = readIntQuery(query.Get("limit"), defaultListLimit); err != nil || filter.Limit < 1 || filter.Limit > maxListLimit {
+		return filter, fmt.Errorf("limit must be a number between 1 and %d", maxListLimit)
+	}
+
+	if value := query.Get("created_from"); value != "" {
+		from, err := parseDateQuery(value, false)
+		if err != nil {
+			return filter, errors.New("created_from must be a RFC 3339 timestamp or a YYYY-MM-DD date")
+		}
+		filter.CreatedFrom = &from
+	}
+
+	if value := query.Get("created_to"); value != "" {
+		to, err := parseDateQuery(value, true)
+		if err != nil {
+			return filter, errors.New("created_to must be a RFC 3339 timestamp or a YYYY-MM-DD date")
+		}
+		filter.CreatedTo = &to
+	}
+
+	intFilters := []struct {
+		name   string
+		target **int
+	}{
+		{"min_duration", &filter.MinDuration},
+		{"min_calories", &filter.MinCalories},
+		{"max_calories", &filter.MaxCalories},
+	}
+	for _, f := range intFilters {
+		value := query.Get(f.name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return filter, fmt.Errorf("%s must be a non-negative number", f.name)
+		}
+		*f.target = &n
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		cursor, err := decodeWorkoutCursor(value)
+		if err != nil {
+			return filter, errors.New("invalid cursor")
+		}
+		filter.Cursor = cursor
+	}
+
+	return filter, nil
+}
+
+func readIntQuery(value string, fallback int) (int, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// parseDateQuery accepts either a full timestamp or a plain date. A plain date
+// used as an upper bound covers the whole day.
+func parseDateQuery(value string, upperBound bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if upperBound {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+func encodeWorkoutCursor(cursor *store.WorkoutCursor) string {
+	raw := fmt.Sprintf("%s|%d", cursor.CreatedAt.UTC().Format(time.RFC3339Nano), cursor.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeWorkoutCursor(value string) (*store.WorkoutCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	createdAt, id, found := strings.Cut(string(raw), "|")
+	if !found {
+		return nil, errors.New("malformed cursor")
+	}
+	cursor := &store.WorkoutCursor{}
+	if cursor.CreatedAt, err = time.Parse(time.RFC3339Nano, createdAt); err != nil {
+		return nil, err
+	}
+	if cursor.ID, err = strconv.Atoi(id); err != nil {
+		return nil, err
+	}
+	return cursor, nil
+}
+
 func (wh *WorkoutHandler) Create(w http.ResponseWriter, r *http.Request) {
 	var workout store.Workout
 	err := json.NewDecoder(r.Body).Decode(&workout)
 	if err != nil {
 		wh.logger.Printf("ERROR: invalid body: %v", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
-			"error": "invalid request body",
-		})
+		problem.Write(w, r, problem.InvalidBody, "invalid request body")
 		return
 	}
 
 	currentUser := middleware.GetUser(r)
 	if currentUser == nil || currentUser == store.AnonymousUser {
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "you must bed logged in"})
+		problem.Write(w, r, problem.AuthenticationRequired, "you must be logged in to access this route")
 		return
 	}
 
+	system, ok := requestUnits(w, r)
+	if !ok {
+		return
+	}
+	canonicalizeEntries(workout.Entries, nil, system)
+
 	workout.UserID = currentUser.ID
+	if workout.Visibility == "" {
+		workout.Visibility = store.VisibilityPrivate
+	}
+
+	v := validator.New()
+	if validateWorkout(v, &workout); !v.Valid() {
+		problem.WriteValidation(w, r, v.Errors)
+		return
+	}
 
 	createdWorkout, err := wh.store.Create(&workout)
+	if errors.Is(err, store.ErrUnknownExercise) {
+		problem.WriteValidation(w, r, map[string]string{"entries": err.Error()})
+		return
+	}
 	if err != nil {
 		wh.logger.Printf("ERROR: create workout: %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
-			"error": "internal server error",
-		})
+		problem.ServerError(w, r)
 		return
 	}
 
+	w.Header().Set("ETag", workoutETag(createdWorkout, system))
 	utils.WriteJSON(w, http.StatusCreated, utils.Envelope{
-		"data": createdWorkout,
+		"data": localizeWorkout(createdWorkout, system),
 	})
 }
 
@@ -92,42 +331,51 @@ func (wh *WorkoutHandler) UpdateById(w http.ResponseWriter, r *http.Request) {
 	workoutId, err := utils.ReadIdParam(r)
 	if err != nil {
 		wh.logger.Printf("ERROR: reading workout ID: %v", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
-			"error": "Invalid workout ID",
-		})
+		problem.Write(w, r, problem.InvalidParameter, "invalid workout ID")
 		return
 	}
 
 	workout, err := wh.store.GetByID(workoutId)
 	if err != nil {
 		wh.logger.Printf("ERROR: get workout: %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
-			"error": "internal server error",
-		})
+		problem.ServerError(w, r)
 		return
 	}
 
 	if workout == nil {
-		utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{
-			"error": "not found",
-		})
+		problem.Write(w, r, problem.NotFound, "workout not found")
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if workout.UserID != currentUser.ID {
+		wh.writeNotOwner(w, r, workout, currentUser)
+		return
+	}
+
+	system, ok := requestUnits(w, r)
+	if !ok {
+		return
+	}
+
+	if !checkIfMatch(w, r, workout, system) {
 		return
 	}
 
 	var updateWorkout struct {
-		Title           *string              `json:"title"`
-		Description     *string              `json:"description"`
-		DurationMinutes *int                 `json:"duration_minutes"`
-		CaloriesBurned  *int                 `json:"calories_burned"`
-		Entries         []store.WorkoutEntry `json:"entries"`
+		Title           *string                   `json:"title"`
+		Description     *string                   `json:"description"`
+		DurationMinutes *int                      `json:"duration_minutes"`
+		CaloriesBurned  *int                      `json:"calories_burned"`
+		Visibility      *string                   `json:"visibility"`
+		Groups          []store.WorkoutEntryGroup `json:"groups"`
+		Entries         []store.WorkoutEntry      `json:"entries"`
 	}
 
 	err = json.NewDecoder(r.Body).Decode(&updateWorkout)
 	if err != nil {
 		wh.logger.Printf("ERROR: decoding: %v", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
-			"error": "invalid request body",
-		})
+		problem.Write(w, r, problem.InvalidBody, "invalid request body")
 		return
 	}
 
@@ -143,92 +391,168 @@ func (wh *WorkoutHandler) UpdateById(w http.ResponseWriter, r *http.Request) {
 	if updateWorkout.CaloriesBurned != nil {
 		workout.CaloriesBurned = *updateWorkout.CaloriesBurned
 	}
+	if updateWorkout.Visibility != nil {
+		workout.Visibility = *updateWorkout.Visibility
+	}
+	if updateWorkout.Groups != nil {
+		workout.Groups = updateWorkout.Groups
+	}
 	if updateWorkout.Entries != nil {
+		canonicalizeEntries(updateWorkout.Entries, workout.Entries, system)
 		workout.Entries = updateWorkout.Entries
 	}
 
-	currentUser := middleware.GetUser(r)
-	if currentUser == nil || currentUser == store.AnonymousUser {
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "you must be logged in to update"})
+	v := validator.New()
+	if validateWorkout(v, workout); !v.Valid() {
+		problem.WriteValidation(w, r, v.Errors)
 		return
 	}
 
-	workoutOwner, err := wh.store.GetWorkoutOwner(workoutId)
+	err = wh.store.Update(workout)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout does not exist"})
-			return
-		}
+		wh.writeUpdateError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", workoutETag(workout, system))
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
+		"data": localizeWorkout(workout, system),
+	})
+}
+
+func (wh *WorkoutHandler) DeleteById(w http.ResponseWriter, r *http.Request) {
+	workoutId, err := utils.ReadIdParam(r)
+	if err != nil {
+		wh.logger.Printf("ERROR: reading workout ID: %v", err)
+		problem.Write(w, r, problem.InvalidParameter, "invalid workout ID")
+		return
+	}
 
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+	workout, err := wh.store.GetByID(workoutId)
+	if err != nil {
+		wh.logger.Printf("ERROR: get workout: %v", err)
+		problem.ServerError(w, r)
 		return
 	}
 
-	if workoutOwner != currentUser.ID {
-		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you are not authorized to update this workout"})
+	if workout == nil {
+		problem.Write(w, r, problem.NotFound, "workout not found")
 		return
 	}
 
-	err = wh.store.Update(workout)
+	currentUser := middleware.GetUser(r)
+	if workout.UserID != currentUser.ID {
+		wh.writeNotOwner(w, r, workout, currentUser)
+		return
+	}
+
+	system, ok := requestUnits(w, r)
+	if !ok {
+		return
+	}
+
+	if !checkIfMatch(w, r, workout, system) {
+		return
+	}
+
+	err = wh.store.Delete(workoutId, workout.Version)
 	if err != nil {
-		wh.logger.Printf("ERROR: update workout: %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
-			"error": "internal server error",
-		})
+		if errors.Is(err, store.ErrVersionConflict) {
+			problem.Write(w, r, problem.PreconditionFailed, "workout has been modified")
+			return
+		}
+		if err == sql.ErrNoRows {
+			problem.Write(w, r, problem.NotFound, "workout not found")
+			return
+		}
+		wh.logger.Printf("ERROR: delete workout: %v", err)
+		problem.ServerError(w, r)
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusOK, utils.Envelope{
-		"data": workout,
-	})
+	utils.WriteJSON(w, http.StatusNoContent, nil)
 }
 
-func (wh *WorkoutHandler) DeleteById(w http.ResponseWriter, r *http.Request) {
+func (wh *WorkoutHandler) Restore(w http.ResponseWriter, r *http.Request) {
 	workoutId, err := utils.ReadIdParam(r)
 	if err != nil {
 		wh.logger.Printf("ERROR: reading workout ID: %v", err)
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{
-			"error": "Invalid workout ID",
-		})
+		problem.Write(w, r, problem.InvalidParameter, "invalid workout ID")
 		return
 	}
 
-	currentUser := middleware.GetUser(r)
-	if currentUser == nil || currentUser == store.AnonymousUser {
-		utils.WriteJSON(w, http.StatusBadRequest, utils.Envelope{"error": "you must be logged in to update"})
+	system, ok := requestUnits(w, r)
+	if !ok {
 		return
 	}
 
 	workoutOwner, err := wh.store.GetWorkoutOwner(workoutId)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		wh.logger.Printf("ERROR: get workout owner: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	// other users' trash is never visible, so it is reported as missing
+	if err != nil || workoutOwner != middleware.GetUser(r).ID {
+		problem.Write(w, r, problem.NotFound, "workout not found")
+		return
+	}
+
+	err = wh.store.Restore(workoutId)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{"error": "workout does not exist"})
+			problem.Write(w, r, problem.NotFound, "workout not found")
 			return
 		}
-
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{"error": "internal server error"})
+		wh.logger.Printf("ERROR: restore workout: %v", err)
+		problem.ServerError(w, r)
 		return
 	}
 
-	if workoutOwner != currentUser.ID {
-		utils.WriteJSON(w, http.StatusForbidden, utils.Envelope{"error": "you are not authorized to update this workout"})
+	workout, err := wh.store.GetByID(workoutId)
+	if err != nil || workout == nil {
+		wh.logger.Printf("ERROR: get restored workout: %v", err)
+		problem.ServerError(w, r)
 		return
 	}
 
-	err = wh.store.Delete(workoutId)
+	w.Header().Set("ETag", workoutETag(workout, system))
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": localizeWorkout(workout, system)})
+}
+
+// writeUpdateError reports a failed store.Update. A version conflict means
+// someone else saved the workout in between our read and write.
+func (wh *WorkoutHandler) writeUpdateError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrVersionConflict):
+		problem.Write(w, r, problem.PreconditionFailed, "workout has been modified")
+	case errors.Is(err, sql.ErrNoRows):
+		problem.Write(w, r, problem.NotFound, "workout not found")
+	case errors.Is(err, store.ErrUnknownExercise):
+		problem.WriteValidation(w, r, map[string]string{"entries": err.Error()})
+	case errors.Is(err, store.ErrEntryLoggedPerSet):
+		problem.WriteValidation(w, r, map[string]string{"set_details": err.Error()})
+	default:
+		wh.logger.Printf("ERROR: update workout: %v", err)
+		problem.ServerError(w, r)
+	}
+}
+
+// writeNotOwner answers 403 only when the caller is allowed to see the workout,
+// otherwise it pretends the workout doesn't exist.
+func (wh *WorkoutHandler) writeNotOwner(w http.ResponseWriter, r *http.Request, workout *store.Workout, user *store.User) {
+	visible, err := wh.canView(workout, user)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			utils.WriteJSON(w, http.StatusNotFound, utils.Envelope{
-				"error": "not found",
-			})
-			return
-		}
-		wh.logger.Printf("ERROR: delete workout: %v", err)
-		utils.WriteJSON(w, http.StatusInternalServerError, utils.Envelope{
-			"error": "internal server error",
-		})
+		wh.logger.Printf("ERROR: check workout visibility: %v", err)
+		problem.ServerError(w, r)
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusNoContent, nil)
+	if !visible {
+		problem.Write(w, r, problem.NotFound, "workout not found")
+		return
+	}
+
+	problem.Write(w, r, problem.Forbidden, "you are not authorized to modify this workout")
 }
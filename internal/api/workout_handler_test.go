@@ -0,0 +1,46 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/joao-vitor-felix/workout-api/internal/store"
+	"github.com/joao-vitor-felix/workout-api/internal/units"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckIfMatch(t *testing.T) {
+	workout := &store.Workout{ID: 7, Version: 3}
+	assert.NotEqual(t, workoutETag(workout, units.Metric), workoutETag(workout, units.Imperial))
+
+	tests := []struct {
+		name    string
+		ifMatch string
+		want    bool
+	}{
+		{"no precondition", "", true},
+		{"any version", "*", true},
+		{"read in the request's units", `"3-imperial"`, true},
+		{"read in the other units", `"3-metric"`, true},
+		{"one of several", `"2-imperial", "3-imperial"`, true},
+		{"older version", `"2-imperial"`, false},
+		{"weak tag", `W/"3-imperial"`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPatch, "/workouts/7", nil)
+			if tt.ifMatch != "" {
+				r.Header.Set("If-Match", tt.ifMatch)
+			}
+
+			assert.Equal(t, tt.want, checkIfMatch(w, r, workout, units.Imperial))
+			if !tt.want {
+				assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+				assert.Equal(t, `"3-imperial"`, w.Header().Get("ETag"))
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/joao-vitor-felix/workout-api/internal/jsonpatch"
+	"github.com/joao-vitor-felix/workout-api/internal/middleware"
+	"github.com/joao-vitor-felix/workout-api/internal/problem"
+	"github.com/joao-vitor-felix/workout-api/internal/store"
+	"github.com/joao-vitor-felix/workout-api/internal/utils"
+	"github.com/joao-vitor-felix/workout-api/internal/validator"
+)
+
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+	maxPatchBodySize      = 1 << 20
+)
+
+// workoutPatchDocument is the part of a workout a patch is applied to. Fields
+// that aren't listed here can't be patched.
+type workoutPatchDocument struct {
+	Title           string                    `json:"title"`
+	Description     string                    `json:"description"`
+	DurationMinutes int                       `json:"duration_minutes"`
+	CaloriesBurned  int                       `json:"calories_burned"`
+	Visibility      string                    `json:"visibility"`
+	Groups          []store.WorkoutEntryGroup `json:"groups"`
+	Entries         []store.WorkoutEntry      `json:"entries"`
+}
+
+// PatchById applies a JSON Merge Patch or a JSON Patch to a workout. Entries
+// can be addressed by position or as "id:<entry id>", and their order_index
+// follows their position in the patched list.
+func (wh *WorkoutHandler) PatchById(w http.ResponseWriter, r *http.Request) {
+	workoutId, err := utils.ReadIdParam(r)
+	if err != nil {
+		problem.Write(w, r, problem.InvalidParameter, "invalid workout ID")
+		return
+	}
+
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if contentType != mergePatchContentType && contentType != jsonPatchContentType {
+		w.Header().Set("Accept-Patch", mergePatchContentType+", "+jsonPatchContentType)
+		problem.Write(w, r, problem.UnsupportedMediaType, "content type must be "+mergePatchContentType+" or "+jsonPatchContentType)
+		return
+	}
+
+	workout, err := wh.store.GetByID(workoutId)
+	if err != nil {
+		wh.logger.Printf("ERROR: get workout: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	if workout == nil {
+		problem.Write(w, r, problem.NotFound, "workout not found")
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if workout.UserID != currentUser.ID {
+		wh.writeNotOwner(w, r, workout, currentUser)
+		return
+	}
+
+	// the patch is written against the workout as the client sees it
+	system, ok := requestUnits(w, r)
+	if !ok {
+		return
+	}
+
+	if !checkIfMatch(w, r, workout, system) {
+		return
+	}
+	localized := localizeWorkout(workout, system)
+
+	patch, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPatchBodySize))
+	if err != nil {
+		problem.Write(w, r, problem.PayloadTooLarge, "request body too large")
+		return
+	}
+
+	doc, err := json.Marshal(workoutPatchDocument{
+		Title:           workout.Title,
+		Description:     workout.Description,
+		DurationMinutes: workout.DurationMinutes,
+		CaloriesBurned:  workout.CaloriesBurned,
+		Visibility:      workout.Visibility,
+		Groups:          workout.Groups,
+		Entries:         localized.Entries,
+	})
+	if err != nil {
+		wh.logger.Printf("ERROR: encode workout: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	var patched []byte
+	if contentType == mergePatchContentType {
+		patched, err = jsonpatch.MergePatch(doc, patch)
+	} else {
+		patched, err = jsonpatch.Apply(doc, patch)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, jsonpatch.ErrTestFailed):
+			problem.Write(w, r, problem.Conflict, err.Error())
+		case errors.Is(err, jsonpatch.ErrInvalidPatch):
+			problem.Write(w, r, problem.Unprocessable, err.Error())
+		default:
+			wh.logger.Printf("ERROR: apply workout patch: %v", err)
+			problem.ServerError(w, r)
+		}
+		return
+	}
+
+	var result workoutPatchDocument
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&result)
+	if err != nil {
+		problem.Write(w, r, problem.Unprocessable, "patched workout is invalid: "+err.Error())
+		return
+	}
+
+	for i := range result.Entries {
+		result.Entries[i].OrderIndex = i + 1
+	}
+	canonicalizeEntries(result.Entries, workout.Entries, system)
+
+	// the middleware can't tell what a patch publishes without the workout
+	if result.Visibility == store.VisibilityPublic && !middleware.CanPublish(wh.unverifiedPolicy, currentUser) {
+		problem.Write(w, r, problem.EmailUnverified, "you must verify your email to publish public content")
+		return
+	}
+
+	workout.Title = result.Title
+	workout.Description = result.Description
+	workout.DurationMinutes = result.DurationMinutes
+	workout.CaloriesBurned = result.CaloriesBurned
+	workout.Visibility = result.Visibility
+	workout.Groups = result.Groups
+	workout.Entries = result.Entries
+
+	v := validator.New()
+	if validateWorkout(v, workout); !v.Valid() {
+		problem.WriteValidation(w, r, v.Errors)
+		return
+	}
+
+	err = wh.store.Update(workout)
+	if err != nil {
+		wh.writeUpdateError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", workoutETag(workout, system))
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": localizeWorkout(workout, system)})
+}
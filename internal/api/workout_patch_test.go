@@ -0,0 +1,75 @@
+package api
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/joao-vitor-felix/workout-api/internal/middleware"
+	"github.com/joao-vitor-felix/workout-api/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPatchByIdUnverified(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		patch       string
+		status      int
+	}{
+		{
+			name:        "merge patch to public",
+			contentType: mergePatchContentType,
+			patch:       `{"visibility": "public"}`,
+			status:      http.StatusForbidden,
+		},
+		{
+			name:        "json patch replacing the document",
+			contentType: jsonPatchContentType,
+			patch:       `[{"op": "replace", "path": "", "value": {"title": "Push day", "visibility": "public", "entries": [{"exercise_name": "Bench press", "sets": 3, "reps": 5, "order_index": 1}]}}]`,
+			status:      http.StatusForbidden,
+		},
+		{
+			name:        "private title change",
+			contentType: mergePatchContentType,
+			patch:       `{"title": "Pull day"}`,
+			status:      http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workoutStore := &stubWorkoutStore{
+				workout: &store.Workout{
+					ID:         7,
+					UserID:     1,
+					Title:      "Push day",
+					Visibility: store.VisibilityPrivate,
+					Version:    1,
+					Entries: []store.WorkoutEntry{
+						{ID: 1, ExerciseName: "Bench press", Sets: 3, Reps: intPtr(5), OrderIndex: 1},
+					},
+				},
+			}
+			handler := NewWorkoutHandler(workoutStore, nil, middleware.UnverifiedNoPublic, log.New(io.Discard, "", 0))
+
+			w := httptest.NewRecorder()
+			r := newWorkoutRequest(http.MethodPatch, "/workouts/7", strings.NewReader(tt.patch), &store.User{ID: 1}, map[string]string{"id": "7"})
+			r.Header.Set("Content-Type", tt.contentType)
+
+			handler.PatchById(w, r)
+
+			assert.Equal(t, tt.status, w.Code, w.Body.String())
+			if tt.status == http.StatusForbidden {
+				assert.Nil(t, workoutStore.updated)
+			}
+		})
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/joao-vitor-felix/workout-api/internal/middleware"
+	"github.com/joao-vitor-felix/workout-api/internal/problem"
+	"github.com/joao-vitor-felix/workout-api/internal/store"
+	"github.com/joao-vitor-felix/workout-api/internal/utils"
+)
+
+type workoutRevisionResponse struct {
+	Revision  int               `json:"revision"`
+	CreatedAt time.Time         `json:"created_at"`
+	Changes   store.WorkoutDiff `json:"changes"`
+}
+
+// ListRevisions lists the saved revisions of a workout, each with the changes
+// made by the update that followed it. Earlier revisions may hold content the
+// owner never published, so only the owner can see them.
+func (wh *WorkoutHandler) ListRevisions(w http.ResponseWriter, r *http.Request) {
+	workoutId, err := utils.ReadIdParam(r)
+	if err != nil {
+		problem.Write(w, r, problem.InvalidParameter, "invalid workout ID")
+		return
+	}
+
+	workout, err := wh.store.GetByID(workoutId)
+	if err != nil {
+		wh.logger.Printf("ERROR: get workout by ID: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	if workout == nil {
+		problem.Write(w, r, problem.NotFound, "workout not found")
+		return
+	}
+
+	if workout.UserID != middleware.GetUser(r).ID {
+		problem.Write(w, r, problem.NotFound, "workout not found")
+		return
+	}
+
+	system, ok := requestUnits(w, r)
+	if !ok {
+		return
+	}
+
+	revisions, err := wh.store.ListRevisions(workoutId)
+	if err != nil {
+		wh.logger.Printf("ERROR: list workout revisions: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	response := make([]workoutRevisionResponse, len(revisions))
+	for i, revision := range revisions {
+		next := workout
+		if i+1 < len(revisions) {
+			next = revisions[i+1].Snapshot
+		}
+		response[i] = workoutRevisionResponse{
+			Revision:  revision.Revision,
+			CreatedAt: revision.CreatedAt,
+			Changes:   store.DiffWorkouts(localizeWorkout(revision.Snapshot, system), localizeWorkout(next, system)),
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": response})
+}
+
+// RestoreRevision puts a workout back the way it was at a revision. The
+// restore is an update itself, so it can be rolled back too.
+func (wh *WorkoutHandler) RestoreRevision(w http.ResponseWriter, r *http.Request) {
+	workoutId, err := utils.ReadIdParam(r)
+	if err != nil {
+		problem.Write(w, r, problem.InvalidParameter, "invalid workout ID")
+		return
+	}
+
+	revisionNumber, err := utils.ReadIntParam(r, "rev")
+	if err != nil {
+		problem.Write(w, r, problem.InvalidParameter, "invalid revision")
+		return
+	}
+
+	workout, err := wh.store.GetByID(workoutId)
+	if err != nil {
+		wh.logger.Printf("ERROR: get workout: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	if workout == nil {
+		problem.Write(w, r, problem.NotFound, "workout not found")
+		return
+	}
+
+	currentUser := middleware.GetUser(r)
+	if workout.UserID != currentUser.ID {
+		wh.writeNotOwner(w, r, workout, currentUser)
+		return
+	}
+
+	system, ok := requestUnits(w, r)
+	if !ok {
+		return
+	}
+
+	if !checkIfMatch(w, r, workout, system) {
+		return
+	}
+
+	revision, err := wh.store.GetRevision(workoutId, int(revisionNumber))
+	if err != nil {
+		wh.logger.Printf("ERROR: get workout revision: %v", err)
+		problem.ServerError(w, r)
+		return
+	}
+
+	if revision == nil {
+		problem.Write(w, r, problem.NotFound, "revision not found")
+		return
+	}
+
+	snapshot := revision.Snapshot
+	if snapshot.Visibility == store.VisibilityPublic && !middleware.CanPublish(wh.unverifiedPolicy, currentUser) {
+		problem.Write(w, r, problem.EmailUnverified, "you must verify your email to publish public content")
+		return
+	}
+
+	workout.Title = snapshot.Title
+	workout.Description = snapshot.Description
+	workout.DurationMinutes = snapshot.DurationMinutes
+	workout.CaloriesBurned = snapshot.CaloriesBurned
+	workout.Visibility = snapshot.Visibility
+	workout.Groups = snapshot.Groups
+	workout.Entries = snapshot.Entries
+
+	err = wh.store.Update(workout)
+	if err != nil {
+		wh.writeUpdateError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", workoutETag(workout, system))
+	utils.WriteJSON(w, http.StatusOK, utils.Envelope{"data": localizeWorkout(workout, system)})
+}
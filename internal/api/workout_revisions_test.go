@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/joao-vitor-felix/workout-api/internal/middleware"
+	"github.com/joao-vitor-felix/workout-api/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubWorkoutStore serves a single workout and its revisions. Methods the
+// tests don't need panic through the nil embedded interface.
+type stubWorkoutStore struct {
+	store.WorkoutStore
+	workout   *store.Workout
+	revisions []*store.WorkoutRevision
+	updated   *store.Workout
+}
+
+func (s *stubWorkoutStore) GetByID(id int64) (*store.Workout, error) {
+	if s.workout == nil || int64(s.workout.ID) != id {
+		return nil, nil
+	}
+	copied := *s.workout
+	return &copied, nil
+}
+
+func (s *stubWorkoutStore) ListRevisions(workoutID int64) ([]*store.WorkoutRevision, error) {
+	return s.revisions, nil
+}
+
+func (s *stubWorkoutStore) GetRevision(workoutID int64, revision int) (*store.WorkoutRevision, error) {
+	for _, candidate := range s.revisions {
+		if candidate.Revision == revision {
+			return candidate, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *stubWorkoutStore) Update(workout *store.Workout) error {
+	workout.Version++
+	s.updated = workout
+	return nil
+}
+
+// newWorkoutRequest builds a request for the workout routes as user, with
+// the given chi URL parameters.
+func newWorkoutRequest(method, target string, body io.Reader, user *store.User, params map[string]string) *http.Request {
+	r := httptest.NewRequest(method, target, body)
+	routeContext := chi.NewRouteContext()
+	for key, value := range params {
+		routeContext.URLParams.Add(key, value)
+	}
+	r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, routeContext))
+	return middleware.SetUser(r, user)
+}
+
+func TestListRevisions(t *testing.T) {
+	owner := &store.User{ID: 1}
+	follower := &store.User{ID: 2}
+
+	workoutStore := &stubWorkoutStore{
+		workout: &store.Workout{ID: 7, UserID: owner.ID, Title: "Push day", Visibility: store.VisibilityPublic, Version: 2},
+		revisions: []*store.WorkoutRevision{
+			{
+				WorkoutID: 7,
+				Revision:  1,
+				Snapshot:  &store.Workout{ID: 7, UserID: owner.ID, Title: "Secret plan", Visibility: store.VisibilityPrivate, Version: 1},
+				CreatedAt: time.Now(),
+			},
+		},
+	}
+	handler := NewWorkoutHandler(workoutStore, nil, middleware.UnverifiedNoPublic, log.New(io.Discard, "", 0))
+
+	tests := []struct {
+		name   string
+		user   *store.User
+		status int
+	}{
+		{"owner", owner, http.StatusOK},
+		{"other user of a public workout", follower, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := newWorkoutRequest(http.MethodGet, "/workouts/7/revisions", nil, tt.user, map[string]string{"id": "7"})
+
+			handler.ListRevisions(w, r)
+
+			assert.Equal(t, tt.status, w.Code)
+			if tt.status != http.StatusOK {
+				assert.NotContains(t, w.Body.String(), "Secret plan")
+			}
+		})
+	}
+}
+
+func TestRestoreRevisionUnverified(t *testing.T) {
+	unverified := &store.User{ID: 1}
+	verifiedAt := time.Now()
+	verified := &store.User{ID: 1, EmailVerifiedAt: &verifiedAt}
+
+	tests := []struct {
+		name       string
+		user       *store.User
+		visibility string
+		status     int
+	}{
+		{"unverified restoring a public revision", unverified, store.VisibilityPublic, http.StatusForbidden},
+		{"unverified restoring a private revision", unverified, store.VisibilityPrivate, http.StatusOK},
+		{"verified restoring a public revision", verified, store.VisibilityPublic, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workoutStore := &stubWorkoutStore{
+				workout: &store.Workout{ID: 7, UserID: 1, Title: "Push day", Visibility: store.VisibilityPrivate, Version: 2},
+				revisions: []*store.WorkoutRevision{
+					{
+						WorkoutID: 7,
+						Revision:  1,
+						Snapshot:  &store.Workout{ID: 7, UserID: 1, Title: "Push day", Visibility: tt.visibility, Version: 1},
+					},
+				},
+			}
+			handler := NewWorkoutHandler(workoutStore, nil, middleware.UnverifiedNoPublic, log.New(io.Discard, "", 0))
+
+			w := httptest.NewRecorder()
+			r := newWorkoutRequest(http.MethodPost, "/workouts/7/revisions/1/restore", nil, tt.user, map[string]string{"id": "7", "rev": "1"})
+
+			handler.RestoreRevision(w, r)
+
+			assert.Equal(t, tt.status, w.Code)
+			if tt.status == http.StatusForbidden {
+				assert.Nil(t, workoutStore.updated)
+			}
+		})
+	}
+}
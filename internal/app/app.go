@@ -1,24 +1,37 @@
 package app
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/jackc/pgx/v5/stdlib"
 	"github.com/joao-vitor-felix/workout-api/internal/api"
+	"github.com/joao-vitor-felix/workout-api/internal/mailer"
 	"github.com/joao-vitor-felix/workout-api/internal/middleware"
 	"github.com/joao-vitor-felix/workout-api/internal/store"
 	"github.com/joao-vitor-felix/workout-api/migrations"
+	"github.com/joao-vitor-felix/workout-api/seeds"
 )
 
 type Application struct {
-	Logger         *log.Logger
-	WorkoutHandler *api.WorkoutHandler
-	UserHandler    *api.UserHandler
-	TokenHandler   *api.TokenHandler
-	Middleware     middleware.UserMiddleware
-	DBPool         *pgxpool.Pool
+	Logger           *log.Logger
+	WorkoutHandler   *api.WorkoutHandler
+	UserHandler      *api.UserHandler
+	TokenHandler     *api.TokenHandler
+	APIKeyHandler    *api.APIKeyHandler
+	TwoFactorHandler *api.TwoFactorHandler
+	AdminHandler     *api.AdminHandler
+	ExerciseHandler  *api.ExerciseHandler
+	FollowHandler    *api.FollowHandler
+	Middleware       middleware.UserMiddleware
+	DBPool           *pgxpool.Pool
+	WorkoutStore     store.WorkoutStore
+	TrashRetention   time.Duration
 }
 
 func NewApplication() (*Application, error) {
@@ -33,21 +46,131 @@ func NewApplication() (*Application, error) {
 		panic(err)
 	}
 	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
+	exerciseStore := store.NewPostgresExerciseStore(stdlib.OpenDBFromPool(dbPool))
+	err = seedExercises(exerciseStore, logger)
+	if err != nil {
+		return nil, err
+	}
 	//TODO: fix db connection for stores
 	workoutStore := store.NewPostgresWorkoutStore(stdlib.OpenDBFromPool(dbPool))
-	workoutHandler := api.NewWorkoutHandler(workoutStore, logger)
+	followStore := store.NewPostgresFollowStore(stdlib.OpenDBFromPool(dbPool))
+	policy := unverifiedPolicy()
+	workoutHandler := api.NewWorkoutHandler(workoutStore, followStore, policy, logger)
 	userStore := store.NewPostgresUserStore(stdlib.OpenDBFromPool(dbPool))
-	userHandler := api.NewUserHandler(userStore, logger)
 	tokenStore := store.NewPostgresTokenStore(stdlib.OpenDBFromPool(dbPool))
-	tokenHandler := api.NewTokenHandler(tokenStore, userStore, logger)
-	middlewareHandler := middleware.UserMiddleware{UserStore: userStore}
+	mail, err := newMailer(logger)
+	if err != nil {
+		return nil, err
+	}
+	userHandler := api.NewUserHandler(userStore, tokenStore, workoutStore, mail, appURL(), logger)
+	loginAttemptStore := store.NewPostgresLoginAttemptStore(stdlib.OpenDBFromPool(dbPool))
+	twoFactorStore := store.NewPostgresTwoFactorStore(stdlib.OpenDBFromPool(dbPool))
+	tokenHandler := api.NewTokenHandler(tokenStore, userStore, loginAttemptStore, twoFactorStore, logger)
+	twoFactorHandler := api.NewTwoFactorHandler(twoFactorStore, logger)
+	adminHandler := api.NewAdminHandler(userStore, tokenStore, workoutStore, logger)
+	apiKeyStore := store.NewPostgresAPIKeyStore(stdlib.OpenDBFromPool(dbPool))
+	apiKeyHandler := api.NewAPIKeyHandler(apiKeyStore, logger)
+	exerciseHandler := api.NewExerciseHandler(exerciseStore, logger)
+	followHandler := api.NewFollowHandler(followStore, logger)
+	middlewareHandler := middleware.UserMiddleware{
+		UserStore:        userStore,
+		TokenStore:       tokenStore,
+		APIKeyStore:      apiKeyStore,
+		UnverifiedPolicy: policy,
+		Logger:           logger,
+	}
 	app := &Application{
-		Logger:         logger,
-		WorkoutHandler: workoutHandler,
-		UserHandler:    userHandler,
-		TokenHandler:   tokenHandler,
-		Middleware:     middlewareHandler,
-		DBPool:         dbPool,
+		Logger:           logger,
+		WorkoutHandler:   workoutHandler,
+		UserHandler:      userHandler,
+		TokenHandler:     tokenHandler,
+		APIKeyHandler:    apiKeyHandler,
+		TwoFactorHandler: twoFactorHandler,
+		AdminHandler:     adminHandler,
+		ExerciseHandler:  exerciseHandler,
+		FollowHandler:    followHandler,
+		Middleware:       middlewareHandler,
+		DBPool:           dbPool,
+		WorkoutStore:     workoutStore,
+		TrashRetention:   trashRetention(logger),
 	}
 	return app, nil
 }
+
+// seedExercises adds the bundled exercises missing from the catalog.
+func seedExercises(exerciseStore store.ExerciseStore, logger *log.Logger) error {
+	seeded, err := exerciseStore.Seed(seeds.FS, "exercises.json")
+	if err != nil {
+		return fmt.Errorf("seed exercises: %w", err)
+	}
+
+	if seeded > 0 {
+		logger.Printf("INFO: seeded %d exercises", seeded)
+	}
+	return nil
+}
+
+// newMailer writes emails to MAILER_DIR when it is set and to the log otherwise.
+func newMailer(logger *log.Logger) (mailer.Mailer, error) {
+	if dir := os.Getenv("MAILER_DIR"); dir != "" {
+		return mailer.NewFileMailer(dir)
+	}
+	return mailer.NewLogMailer(logger), nil
+}
+
+func appURL() string {
+	if url := os.Getenv("APP_URL"); url != "" {
+		return strings.TrimRight(url, "/")
+	}
+	return "http://localhost:8080"
+}
+
+func unverifiedPolicy() string {
+	switch policy := os.Getenv("UNVERIFIED_POLICY"); policy {
+	case middleware.UnverifiedAllowAll, middleware.UnverifiedReadOnly:
+		return policy
+	default:
+		return middleware.UnverifiedNoPublic
+	}
+}
+
+const (
+	defaultTrashRetention = 30 * 24 * time.Hour
+	trashPurgeInterval    = time.Hour
+)
+
+func trashRetention(logger *log.Logger) time.Duration {
+	value := os.Getenv("TRASH_RETENTION")
+	if value == "" {
+		return defaultTrashRetention
+	}
+
+	retention, err := time.ParseDuration(value)
+	if err != nil || retention <= 0 {
+		logger.Printf("WARN: invalid TRASH_RETENTION %q, using %s", value, defaultTrashRetention)
+		return defaultTrashRetention
+	}
+	return retention
+}
+
+// RunTrashPurge permanently deletes workouts that have been in the trash for
+// longer than TrashRetention, until ctx is done.
+func (a *Application) RunTrashPurge(ctx context.Context) {
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := a.WorkoutStore.PurgeDeleted(time.Now().Add(-a.TrashRetention))
+		if err != nil {
+			a.Logger.Printf("ERROR: purge trashed workouts: %v", err)
+		} else if purged > 0 {
+			a.Logger.Printf("INFO: purged %d trashed workouts", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,448 @@
+// Package jsonpatch applies JSON Merge Patch (RFC 7396) and JSON Patch
+// (RFC 6902) documents.
+//
+// Both accept one extension for addressing array elements: besides an index,
+// an element can be referenced as "id:<n>", meaning the object in the array
+// whose "id" member is n. In a merge patch, an object applied to an array
+// edits its elements by index or id ("-" appends, null removes) instead of
+// replacing the whole array.
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidPatch = errors.New("invalid patch")
+	ErrTestFailed   = errors.New("test operation failed")
+)
+
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	patchValue, err := decode(patch)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	result, err := mergePatch(target, patchValue)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(result)
+}
+
+func mergePatch(target, patch any) (any, error) {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch, nil
+	}
+
+	if array, ok := target.([]any); ok {
+		return mergeArray(array, patchObject)
+	}
+
+	targetObject, ok := target.(map[string]any)
+	if !ok {
+		targetObject = map[string]any{}
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+
+		merged, err := mergePatch(targetObject[key], value)
+		if err != nil {
+			return nil, err
+		}
+		targetObject[key] = merged
+	}
+
+	return targetObject, nil
+}
+
+func mergeArray(array []any, patch map[string]any) (any, error) {
+	removed := make(map[int]bool)
+	var appended []any
+
+	for key, value := range patch {
+		if key == "-" {
+			if value != nil {
+				appended = append(appended, value)
+			}
+			continue
+		}
+
+		index, err := resolveIndex(array, key, false)
+		if err != nil {
+			return nil, err
+		}
+
+		if value == nil {
+			removed[index] = true
+			continue
+		}
+
+		merged, err := mergePatch(array[index], value)
+		if err != nil {
+			return nil, err
+		}
+		array[index] = merged
+	}
+
+	result := make([]any, 0, len(array)+len(appended))
+	for i, element := range array {
+		if !removed[i] {
+			result = append(result, element)
+		}
+	}
+
+	return append(result, appended...), nil
+}
+
+func Apply(doc, patch []byte) ([]byte, error) {
+	var operations []Operation
+	err := json.Unmarshal(patch, &operations)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	root, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, operation := range operations {
+		root, err = applyOperation(root, operation)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+
+	return json.Marshal(root)
+}
+
+func applyOperation(root any, operation Operation) (any, error) {
+	path, err := parsePointer(operation.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch operation.Op {
+	case "add", "replace", "test":
+		if operation.Value == nil {
+			return nil, fmt.Errorf("%w: %s requires a value", ErrInvalidPatch, operation.Op)
+		}
+
+		value, err := decode(operation.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+
+		switch operation.Op {
+		case "add":
+			return add(root, path, value)
+		case "replace":
+			return replace(root, path, value)
+		}
+
+		current, err := get(root, path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !equal(current, value) {
+			return nil, fmt.Errorf("%w: %s", ErrTestFailed, operation.Path)
+		}
+		return root, nil
+	case "remove":
+		return remove(root, path)
+	case "move", "copy":
+		from, err := parsePointer(operation.From)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := get(root, from)
+		if err != nil {
+			return nil, err
+		}
+
+		if operation.Op == "copy" {
+			value, err = clone(value)
+			if err != nil {
+				return nil, err
+			}
+			return add(root, path, value)
+		}
+
+		if operation.Path != operation.From && strings.HasPrefix(operation.Path, operation.From+"/") {
+			return nil, fmt.Errorf("%w: cannot move %s into itself", ErrInvalidPatch, operation.From)
+		}
+
+		root, err = remove(root, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(root, path, value)
+	default:
+		return nil, fmt.Errorf("%w: unknown op %q", ErrInvalidPatch, operation.Op)
+	}
+}
+
+func add(root any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return mutate(root, path, func(container any, token string) (any, error) {
+		switch c := container.(type) {
+		case map[string]any:
+			c[token] = value
+			return c, nil
+		case []any:
+			index, err := resolveIndex(c, token, true)
+			if err != nil {
+				return nil, err
+			}
+			c = append(c, nil)
+			copy(c[index+1:], c[index:])
+			c[index] = value
+			return c, nil
+		default:
+			return nil, fmt.Errorf("%w: cannot add to a scalar", ErrInvalidPatch)
+		}
+	})
+}
+
+func remove(root any, path []string) (any, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("%w: cannot remove the whole document", ErrInvalidPatch)
+	}
+
+	return mutate(root, path, func(container any, token string) (any, error) {
+		switch c := container.(type) {
+		case map[string]any:
+			if _, ok := c[token]; !ok {
+				return nil, fmt.Errorf("%w: %q does not exist", ErrInvalidPatch, token)
+			}
+			delete(c, token)
+			return c, nil
+		case []any:
+			index, err := resolveIndex(c, token, false)
+			if err != nil {
+				return nil, err
+			}
+			return append(c[:index], c[index+1:]...), nil
+		default:
+			return nil, fmt.Errorf("%w: cannot remove from a scalar", ErrInvalidPatch)
+		}
+	})
+}
+
+func replace(root any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return mutate(root, path, func(container any, token string) (any, error) {
+		switch c := container.(type) {
+		case map[string]any:
+			if _, ok := c[token]; !ok {
+				return nil, fmt.Errorf("%w: %q does not exist", ErrInvalidPatch, token)
+			}
+			c[token] = value
+			return c, nil
+		case []any:
+			index, err := resolveIndex(c, token, false)
+			if err != nil {
+				return nil, err
+			}
+			c[index] = value
+			return c, nil
+		default:
+			return nil, fmt.Errorf("%w: cannot replace in a scalar", ErrInvalidPatch)
+		}
+	})
+}
+
+// mutate walks to the parent of the last token of path and lets fn change it,
+// storing whatever fn returns back into the tree.
+func mutate(node any, path []string, fn func(container any, token string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return fn(node, path[0])
+	}
+
+	switch c := node.(type) {
+	case map[string]any:
+		child, ok := c[path[0]]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q does not exist", ErrInvalidPatch, path[0])
+		}
+		updated, err := mutate(child, path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		c[path[0]] = updated
+		return c, nil
+	case []any:
+		index, err := resolveIndex(c, path[0], false)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := mutate(c[index], path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		c[index] = updated
+		return c, nil
+	default:
+		return nil, fmt.Errorf("%w: %q does not exist", ErrInvalidPatch, path[0])
+	}
+}
+
+func get(node any, path []string) (any, error) {
+	for _, token := range path {
+		switch c := node.(type) {
+		case map[string]any:
+			child, ok := c[token]
+			if !ok {
+				return nil, fmt.Errorf("%w: %q does not exist", ErrInvalidPatch, token)
+			}
+			node = child
+		case []any:
+			index, err := resolveIndex(c, token, false)
+			if err != nil {
+				return nil, err
+			}
+			node = c[index]
+		default:
+			return nil, fmt.Errorf("%w: %q does not exist", ErrInvalidPatch, token)
+		}
+	}
+	return node, nil
+}
+
+// resolveIndex turns a pointer token into a position in array. With allowEnd
+// the position right after the last element ("-" or len) is accepted too.
+func resolveIndex(array []any, token string, allowEnd bool) (int, error) {
+	if token == "-" && allowEnd {
+		return len(array), nil
+	}
+
+	if id, found := strings.CutPrefix(token, "id:"); found {
+		for i, element := range array {
+			object, ok := element.(map[string]any)
+			if !ok {
+				continue
+			}
+			if number, ok := object["id"].(json.Number); ok && number.String() == id {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("%w: no element with id %s", ErrInvalidPatch, id)
+	}
+
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%w: invalid array index %q", ErrInvalidPatch, token)
+	}
+
+	if index > len(array) || (index == len(array) && !allowEnd) {
+		return 0, fmt.Errorf("%w: array index %d out of range", ErrInvalidPatch, index)
+	}
+
+	return index, nil
+}
+
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: invalid pointer %q", ErrInvalidPatch, pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func decode(data []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value any
+	err := decoder.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func clone(value any) (any, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return decode(data)
+}
+
+func equal(a, b any) bool {
+	switch x := a.(type) {
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		fx, errX := x.Float64()
+		fy, errY := y.Float64()
+		return errX == nil && errY == nil && fx == fy
+	case map[string]any:
+		y, ok := b.(map[string]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for key, value := range x {
+			other, ok := y[key]
+			if !ok || !equal(value, other) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		y, ok := b.([]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
+}
@@ -1,22 +1,45 @@
 package middleware
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"io"
+	"log"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/joao-vitor-felix/workout-api/internal/problem"
 	"github.com/joao-vitor-felix/workout-api/internal/store"
 	"github.com/joao-vitor-felix/workout-api/internal/tokens"
-	"github.com/joao-vitor-felix/workout-api/internal/utils"
+)
+
+// lastUsedInterval bounds how often a token's last_used_at is written.
+const lastUsedInterval = 5 * time.Minute
+
+// Policies for what users who haven't verified their email may do.
+const (
+	UnverifiedAllowAll = "allow"
+	UnverifiedNoPublic = "no-public"
+	UnverifiedReadOnly = "read-only"
 )
 
 type UserMiddleware struct {
-	UserStore store.UserStore
+	UserStore        store.UserStore
+	TokenStore       store.TokenStore
+	APIKeyStore      store.APIKeyStore
+	UnverifiedPolicy string
+	Logger           *log.Logger
 }
 
 type contextKey string
 
-const UserContextKey = contextKey("user")
+const (
+	UserContextKey        = contextKey("user")
+	TokenContextKey       = contextKey("token")
+	PermissionsContextKey = contextKey("permissions")
+)
 
 func SetUser(r *http.Request, user *store.User) *http.Request {
 	ctx := context.WithValue(r.Context(), UserContextKey, user)
@@ -31,6 +54,26 @@ func GetUser(r *http.Request) *store.User {
 	return user
 }
 
+func SetToken(r *http.Request, plainText string) *http.Request {
+	ctx := context.WithValue(r.Context(), TokenContextKey, plainText)
+	return r.WithContext(ctx)
+}
+
+func GetToken(r *http.Request) string {
+	token, _ := r.Context().Value(TokenContextKey).(string)
+	return token
+}
+
+func SetPermissions(r *http.Request, permissions tokens.Permissions) *http.Request {
+	ctx := context.WithValue(r.Context(), PermissionsContextKey, permissions)
+	return r.WithContext(ctx)
+}
+
+func GetPermissions(r *http.Request) tokens.Permissions {
+	permissions, _ := r.Context().Value(PermissionsContextKey).(tokens.Permissions)
+	return permissions
+}
+
 func (um *UserMiddleware) Authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Authorization")
@@ -44,36 +87,180 @@ func (um *UserMiddleware) Authenticate(next http.Handler) http.Handler {
 
 		headerParts := strings.Split(authHeader, " ")
 		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
-			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid authorization header"})
+			problem.Write(w, r, problem.InvalidToken, "invalid authorization header")
 			return
 		}
 
 		token := headerParts[1]
+		if strings.HasPrefix(token, tokens.APIKeyPrefix) {
+			um.authenticateAPIKey(w, r, next, token)
+			return
+		}
+
 		user, err := um.UserStore.GetUserToken(tokens.ScopeAuth, token)
 		if err != nil {
-			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "invalid token"})
+			problem.Write(w, r, problem.InvalidToken, "invalid token")
 			return
 		}
 
 		if user == nil {
-			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "token expired or invalid"})
+			problem.Write(w, r, problem.InvalidToken, "token expired or invalid")
 			return
 		}
 
+		err = um.TokenStore.Touch(token, lastUsedInterval)
+		if err != nil {
+			um.Logger.Printf("ERROR: touch token: %v", err)
+		}
+
 		r = SetUser(r, user)
+		r = SetToken(r, token)
+		r = SetPermissions(r, tokens.Permissions{tokens.PermissionAll})
 		next.ServeHTTP(w, r)
 	})
 }
 
+func (um *UserMiddleware) authenticateAPIKey(w http.ResponseWriter, r *http.Request, next http.Handler, key string) {
+	user, permissions, err := um.UserStore.GetUserAPIKey(key)
+	if err != nil {
+		problem.Write(w, r, problem.InvalidToken, "invalid token")
+		return
+	}
+
+	if user == nil {
+		problem.Write(w, r, problem.InvalidToken, "api key expired or invalid")
+		return
+	}
+
+	err = um.APIKeyStore.Touch(key, lastUsedInterval)
+	if err != nil {
+		um.Logger.Printf("ERROR: touch api key: %v", err)
+	}
+
+	r = SetUser(r, user)
+	r = SetPermissions(r, permissions)
+	next.ServeHTTP(w, r)
+}
+
 func (um *UserMiddleware) RequireUser(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := GetUser(r)
 
 		if user.IsAnonymous() {
-			utils.WriteJSON(w, http.StatusUnauthorized, utils.Envelope{"error": "you must be logged in to access this route"})
+			problem.Write(w, r, problem.AuthenticationRequired, "you must be logged in to access this route")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequirePermission rejects authenticated requests whose credentials were not
+// granted permission. Anonymous requests are left to RequireUser.
+func (um *UserMiddleware) RequirePermission(permission string, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := GetUser(r)
+
+		if !user.IsAnonymous() && !GetPermissions(r).Has(permission) {
+			problem.Write(w, r, problem.PermissionMissing, "missing permission "+permission)
 			return
 		}
 
 		next.ServeHTTP(w, r)
 	})
 }
+
+const maxPeekBodySize = 1 << 20
+
+// CanPublish reports whether policy lets user save public content.
+func CanPublish(policy string, user *store.User) bool {
+	return user.IsAnonymous() || user.IsVerified() || policy == UnverifiedAllowAll
+}
+
+// RequireVerifiedUser applies UnverifiedPolicy to content creation routes.
+// Under UnverifiedNoPublic the request body is inspected so that unverified
+// users can still save private content. Bodies that only describe a change,
+// like patches and revision restores, are checked again by the handler with
+// CanPublish once the result is known.
+func (um *UserMiddleware) RequireVerifiedUser(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := GetUser(r)
+
+		if CanPublish(um.UnverifiedPolicy, user) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		switch um.UnverifiedPolicy {
+		case UnverifiedReadOnly:
+			problem.Write(w, r, problem.EmailUnverified, "you must verify your email to access this route")
+			return
+		default:
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPeekBodySize))
+			if err != nil {
+				problem.Write(w, r, problem.PayloadTooLarge, "request body too large")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			// malformed bodies are left for the handler to reject
+			if publishesContent(body) {
+				problem.Write(w, r, problem.EmailUnverified, "you must verify your email to publish public content")
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// publishesContent reports whether body sets visibility to public, either as
+// a plain or merge patch document or through a JSON Patch operation.
+func publishesContent(body []byte) bool {
+	var content struct {
+		Visibility string `json:"visibility"`
+	}
+	if json.Unmarshal(body, &content) == nil {
+		return content.Visibility == store.VisibilityPublic
+	}
+
+	var operations []struct {
+		Op    string `json:"op"`
+		Path  string `json:"path"`
+		Value any    `json:"value"`
+	}
+	if json.Unmarshal(body, &operations) != nil {
+		return false
+	}
+
+	for _, operation := range operations {
+		if operation.Path != "/visibility" {
+			continue
+		}
+		// copied or moved values can't be checked without the document
+		if operation.Op == "copy" || operation.Op == "move" || operation.Value == store.VisibilityPublic {
+			return true
+		}
+	}
+	return false
+}
+
+func (um *UserMiddleware) RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user := GetUser(r)
+
+			if user.IsAnonymous() {
+				problem.Write(w, r, problem.AuthenticationRequired, "you must be logged in to access this route")
+				return
+			}
+
+			if !user.HasRole(roles...) {
+				problem.Write(w, r, problem.Forbidden, "you are not allowed to access this route")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
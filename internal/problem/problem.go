@@ -0,0 +1,105 @@
+// Package problem writes error responses as RFC 9457 problem details.
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+)
+
+const (
+	ContentType = "application/problem+json"
+	typePrefix  = "urn:workout-api:problem:"
+)
+
+// Kind is a class of problem. Its code is part of the type URI and stays the
+// same across releases, so clients can branch on it.
+type Kind struct {
+	Code   string
+	Status int
+	Title  string
+}
+
+var (
+	BadRequest             = Kind{"bad-request", http.StatusBadRequest, "Bad request"}
+	InvalidBody            = Kind{"invalid-body", http.StatusBadRequest, "Invalid request body"}
+	InvalidParameter       = Kind{"invalid-parameter", http.StatusBadRequest, "Invalid parameter"}
+	AuthenticationRequired = Kind{"authentication-required", http.StatusUnauthorized, "Authentication required"}
+	InvalidCredentials     = Kind{"invalid-credentials", http.StatusUnauthorized, "Invalid credentials"}
+	InvalidToken           = Kind{"invalid-token", http.StatusUnauthorized, "Invalid token"}
+	TokenReused            = Kind{"token-reused", http.StatusUnauthorized, "Token reused"}
+	Forbidden              = Kind{"forbidden", http.StatusForbidden, "Forbidden"}
+	PermissionMissing      = Kind{"permission-missing", http.StatusForbidden, "Permission missing"}
+	EmailUnverified        = Kind{"email-unverified", http.StatusForbidden, "Email not verified"}
+	AccountDisabled        = Kind{"account-disabled", http.StatusForbidden, "Account disabled"}
+	NotFound               = Kind{"not-found", http.StatusNotFound, "Not found"}
+	MethodNotAllowed       = Kind{"method-not-allowed", http.StatusMethodNotAllowed, "Method not allowed"}
+	Conflict               = Kind{"conflict", http.StatusConflict, "Conflict"}
+	DuplicateEmail         = Kind{"duplicate-email", http.StatusConflict, "Email already in use"}
+	DuplicateUsername      = Kind{"duplicate-username", http.StatusConflict, "Username already taken"}
+	PreconditionFailed     = Kind{"precondition-failed", http.StatusPreconditionFailed, "Precondition failed"}
+	PayloadTooLarge        = Kind{"payload-too-large", http.StatusRequestEntityTooLarge, "Payload too large"}
+	UnsupportedMediaType   = Kind{"unsupported-media-type", http.StatusUnsupportedMediaType, "Unsupported media type"}
+	Unprocessable          = Kind{"unprocessable", http.StatusUnprocessableEntity, "Unprocessable request"}
+	ValidationFailed       = Kind{"validation-failed", http.StatusUnprocessableEntity, "Validation failed"}
+	TooManyRequests        = Kind{"too-many-requests", http.StatusTooManyRequests, "Too many requests"}
+	InternalError          = Kind{"internal-error", http.StatusInternalServerError, "Internal server error"}
+)
+
+func (k Kind) Type() string {
+	return typePrefix + k.Code
+}
+
+type Problem struct {
+	Type      string            `json:"type"`
+	Title     string            `json:"title"`
+	Status    int               `json:"status"`
+	Detail    string            `json:"detail,omitempty"`
+	Instance  string            `json:"instance,omitempty"`
+	Errors    map[string]string `json:"errors,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+}
+
+func New(r *http.Request, kind Kind, detail string) *Problem {
+	return &Problem{
+		Type:      kind.Type(),
+		Title:     kind.Title,
+		Status:    kind.Status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		RequestID: chimiddleware.GetReqID(r.Context()),
+	}
+}
+
+func Write(w http.ResponseWriter, r *http.Request, kind Kind, detail string) {
+	WriteProblem(w, New(r, kind, detail))
+}
+
+// WriteValidation reports invalid fields, keyed by field name.
+func WriteValidation(w http.ResponseWriter, r *http.Request, errors map[string]string) {
+	p := New(r, ValidationFailed, "the request has invalid fields")
+	p.Errors = errors
+	WriteProblem(w, p)
+}
+
+// ServerError hides the cause of an unexpected failure, which callers are
+// expected to log themselves.
+func ServerError(w http.ResponseWriter, r *http.Request) {
+	Write(w, r, InternalError, "")
+}
+
+func WriteProblem(w http.ResponseWriter, p *Problem) {
+	data, err := json.MarshalIndent(p, "", " ")
+	if err != nil {
+		http.Error(w, "Failed to marshal JSON", http.StatusInternalServerError)
+		return
+	}
+	data = append(data, '\n')
+	w.Header().Set("Content-Type", ContentType)
+	if p.RequestID != "" {
+		w.Header().Set(chimiddleware.RequestIDHeader, p.RequestID)
+	}
+	w.WriteHeader(p.Status)
+	w.Write(data)
+}
@@ -0,0 +1,49 @@
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteValidation(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/workouts", nil)
+	r = r.WithContext(context.WithValue(r.Context(), chimiddleware.RequestIDKey, "req-1"))
+	w := httptest.NewRecorder()
+
+	WriteValidation(w, r, map[string]string{"title": "title is required"})
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, ContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, "req-1", w.Header().Get(chimiddleware.RequestIDHeader))
+
+	var p Problem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	assert.Equal(t, Problem{
+		Type:      "urn:workout-api:problem:validation-failed",
+		Title:     "Validation failed",
+		Status:    http.StatusUnprocessableEntity,
+		Detail:    "the request has invalid fields",
+		Instance:  "/workouts",
+		Errors:    map[string]string{"title": "title is required"},
+		RequestID: "req-1",
+	}, p)
+}
+
+func TestServerError(t *testing.T) {
+	w := httptest.NewRecorder()
+	ServerError(w, httptest.NewRequest(http.MethodGet, "/workouts/1", nil))
+
+	var p map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, InternalError.Type(), p["type"])
+	assert.NotContains(t, p, "detail")
+	assert.NotContains(t, p, "request_id")
+}
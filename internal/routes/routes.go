@@ -1,24 +1,98 @@
 package routes
 
 import (
+	"net/http"
+
 	"github.com/go-chi/chi/v5"
+	chimiddleware "github.com/go-chi/chi/v5/middleware"
 	"github.com/joao-vitor-felix/workout-api/internal/app"
+	"github.com/joao-vitor-felix/workout-api/internal/problem"
+	"github.com/joao-vitor-felix/workout-api/internal/store"
+	"github.com/joao-vitor-felix/workout-api/internal/tokens"
 )
 
 func SetupRoutes(app *app.Application) *chi.Mux {
 	r := chi.NewRouter()
+	m := app.Middleware
+	r.Use(chimiddleware.RequestID)
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		problem.Write(w, r, problem.NotFound, "route not found")
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		problem.Write(w, r, problem.MethodNotAllowed, r.Method+" is not allowed on this route")
+	})
 	r.Route("/workouts", func(r chi.Router) {
-		r.Use(app.Middleware.Authenticate)
-		r.Get("/{id}", app.Middleware.RequireUser(app.WorkoutHandler.GetById))
-		r.Post("/", app.Middleware.RequireUser(app.WorkoutHandler.Create))
-		r.Put("/{id}", app.Middleware.RequireUser(app.WorkoutHandler.UpdateById))
-		r.Delete("/{id}", app.Middleware.RequireUser(app.WorkoutHandler.DeleteById))
+		r.Use(m.Authenticate)
+		r.Get("/", m.RequireUser(m.RequirePermission(tokens.PermissionWorkoutsRead, app.WorkoutHandler.List)))
+		r.Get("/trash", m.RequireUser(m.RequirePermission(tokens.PermissionWorkoutsRead, app.WorkoutHandler.ListTrash)))
+		r.Get("/{id}", m.RequirePermission(tokens.PermissionWorkoutsRead, app.WorkoutHandler.GetById))
+		r.Get("/{id}/revisions", m.RequireUser(m.RequirePermission(tokens.PermissionWorkoutsRead, app.WorkoutHandler.ListRevisions)))
+		r.Post("/{id}/revisions/{rev}/restore", m.RequireUser(m.RequirePermission(tokens.PermissionWorkoutsWrite, m.RequireVerifiedUser(app.WorkoutHandler.RestoreRevision))))
+		r.Post("/{id}/restore", m.RequireUser(m.RequirePermission(tokens.PermissionWorkoutsWrite, app.WorkoutHandler.Restore)))
+		r.Post("/", m.RequireUser(m.RequirePermission(tokens.PermissionWorkoutsWrite, m.RequireVerifiedUser(app.WorkoutHandler.Create))))
+		r.Put("/{id}", m.RequireUser(m.RequirePermission(tokens.PermissionWorkoutsWrite, m.RequireVerifiedUser(app.WorkoutHandler.UpdateById))))
+		r.Patch("/{id}", m.RequireUser(m.RequirePermission(tokens.PermissionWorkoutsWrite, m.RequireVerifiedUser(app.WorkoutHandler.PatchById))))
+		r.Delete("/{id}", m.RequireUser(m.RequirePermission(tokens.PermissionWorkoutsWrite, app.WorkoutHandler.DeleteById)))
+		r.Post("/{id}/entries", m.RequireUser(m.RequirePermission(tokens.PermissionWorkoutsWrite, app.WorkoutHandler.CreateEntry)))
+		r.Put("/{id}/entries/order", m.RequireUser(m.RequirePermission(tokens.PermissionWorkoutsWrite, app.WorkoutHandler.ReorderEntries)))
+		r.Patch("/{id}/entries/{entryId}", m.RequireUser(m.RequirePermission(tokens.PermissionWorkoutsWrite, app.WorkoutHandler.UpdateEntry)))
+		r.Delete("/{id}/entries/{entryId}", m.RequireUser(m.RequirePermission(tokens.PermissionWorkoutsWrite, app.WorkoutHandler.DeleteEntry)))
+	})
+	r.Route("/exercises", func(r chi.Router) {
+		r.Use(m.Authenticate)
+		r.Get("/", m.RequirePermission(tokens.PermissionWorkoutsRead, app.ExerciseHandler.List))
+		r.Get("/{id}", m.RequirePermission(tokens.PermissionWorkoutsRead, app.ExerciseHandler.GetById))
+		r.Post("/", m.RequireUser(m.RequirePermission(tokens.PermissionWorkoutsWrite, app.ExerciseHandler.Create)))
+		r.Patch("/{id}", m.RequireUser(m.RequirePermission(tokens.PermissionWorkoutsWrite, app.ExerciseHandler.Update)))
+		r.Delete("/{id}", m.RequireUser(m.RequirePermission(tokens.PermissionWorkoutsWrite, app.ExerciseHandler.Delete)))
 	})
 	r.Route("/users", func(r chi.Router) {
 		r.Post("/", app.UserHandler.RegisterUser)
+		r.Post("/password-reset", app.UserHandler.ForgotPassword)
+		r.Put("/password-reset", app.UserHandler.ResetPassword)
+		r.Put("/activate", app.UserHandler.Activate)
+		r.Group(func(r chi.Router) {
+			r.Use(m.Authenticate)
+			r.Post("/{id}/follow", m.RequireUser(m.RequirePermission(tokens.PermissionProfileWrite, app.FollowHandler.Follow)))
+			r.Delete("/{id}/follow", m.RequireUser(m.RequirePermission(tokens.PermissionProfileWrite, app.FollowHandler.Unfollow)))
+		})
+		r.Route("/me", func(r chi.Router) {
+			r.Use(m.Authenticate)
+			r.Get("/", m.RequireUser(m.RequirePermission(tokens.PermissionProfileRead, app.UserHandler.GetMe)))
+			r.Patch("/", m.RequireUser(m.RequirePermission(tokens.PermissionProfileWrite, app.UserHandler.UpdateMe)))
+			r.Delete("/", m.RequireUser(m.RequirePermission(tokens.PermissionAccountManage, app.UserHandler.DeleteMe)))
+			r.Get("/export", m.RequireUser(m.RequirePermission(tokens.PermissionAccountManage, app.UserHandler.Export)))
+			r.Put("/password", m.RequireUser(m.RequirePermission(tokens.PermissionAccountManage, app.UserHandler.ChangePassword)))
+			r.Post("/2fa", m.RequireUser(m.RequirePermission(tokens.PermissionAccountManage, app.TwoFactorHandler.Enroll)))
+			r.Post("/2fa/confirm", m.RequireUser(m.RequirePermission(tokens.PermissionAccountManage, app.TwoFactorHandler.Confirm)))
+			r.Delete("/2fa", m.RequireUser(m.RequirePermission(tokens.PermissionAccountManage, app.TwoFactorHandler.Disable)))
+			r.Get("/api-keys", m.RequireUser(m.RequirePermission(tokens.PermissionAPIKeysManage, app.APIKeyHandler.List)))
+			r.Post("/api-keys", m.RequireUser(m.RequirePermission(tokens.PermissionAPIKeysManage, app.APIKeyHandler.Create)))
+			r.Delete("/api-keys/{id}", m.RequireUser(m.RequirePermission(tokens.PermissionAPIKeysManage, app.APIKeyHandler.Delete)))
+		})
 	})
 	r.Route("/auth", func(r chi.Router) {
 		r.Post("/sign-in", app.TokenHandler.Create)
+		r.Post("/refresh", app.TokenHandler.Refresh)
+		r.Post("/2fa", app.TokenHandler.VerifyTwoFactor)
+		r.Group(func(r chi.Router) {
+			r.Use(m.Authenticate)
+			r.Post("/sign-out", m.RequireUser(m.RequirePermission(tokens.PermissionSessionsManage, app.TokenHandler.SignOut)))
+			r.Post("/sign-out-all", m.RequireUser(m.RequirePermission(tokens.PermissionSessionsManage, app.TokenHandler.SignOutAll)))
+			r.Get("/sessions", m.RequireUser(m.RequirePermission(tokens.PermissionSessionsManage, app.TokenHandler.ListSessions)))
+			r.Delete("/sessions/{id}", m.RequireUser(m.RequirePermission(tokens.PermissionSessionsManage, app.TokenHandler.DeleteSession)))
+		})
+	})
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(m.Authenticate)
+		r.Use(m.RequireRole(store.RoleAdmin))
+		r.Get("/users", m.RequirePermission(tokens.PermissionAdmin, app.AdminHandler.ListUsers))
+		r.Put("/users/{id}/role", m.RequirePermission(tokens.PermissionAdmin, app.AdminHandler.SetRole))
+		r.Post("/users/{id}/disable", m.RequirePermission(tokens.PermissionAdmin, app.AdminHandler.DisableUser))
+		r.Post("/users/{id}/enable", m.RequirePermission(tokens.PermissionAdmin, app.AdminHandler.EnableUser))
+		r.Post("/users/{id}/sign-out", m.RequirePermission(tokens.PermissionAdmin, app.AdminHandler.SignOutUser))
+		r.Delete("/workouts/{id}", m.RequirePermission(tokens.PermissionAdmin, app.AdminHandler.DeleteWorkout))
+		r.Post("/exercises/{id}/promote", m.RequirePermission(tokens.PermissionAdmin, app.ExerciseHandler.Promote))
 	})
 	return r
 }
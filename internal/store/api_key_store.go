@@ -0,0 +1,117 @@
+package store
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/joao-vitor-felix/workout-api/internal/tokens"
+)
+
+type APIKey struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"-"`
+	Name        string     `json:"name"`
+	Prefix      string     `json:"prefix"`
+	Hash        []byte     `json:"-"`
+	Permissions []string   `json:"permissions"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+type APIKeyStore interface {
+	Insert(key *APIKey) error
+	ListForUser(userId int) ([]*APIKey, error)
+	Delete(userId int, id int64) error
+	Touch(plainText string, interval time.Duration) error
+}
+
+type PostgresAPIKeyStore struct {
+	db *sql.DB
+}
+
+func NewPostgresAPIKeyStore(db *sql.DB) *PostgresAPIKeyStore {
+	return &PostgresAPIKeyStore{db}
+}
+
+func (s *PostgresAPIKeyStore) Insert(key *APIKey) error {
+	query := `
+  INSERT INTO api_keys (user_id, name, prefix, hash, permissions, expires_at)
+  VALUES ($1, $2, $3, $4, string_to_array($5, ','), $6)
+  RETURNING id, created_at
+  `
+
+	return s.db.QueryRow(query, key.UserID, key.Name, key.Prefix, key.Hash, strings.Join(key.Permissions, ","), key.ExpiresAt).Scan(&key.ID, &key.CreatedAt)
+}
+
+func (s *PostgresAPIKeyStore) ListForUser(userId int) ([]*APIKey, error) {
+	query := `
+  SELECT id, user_id, name, prefix, array_to_string(permissions, ','), expires_at, last_used_at, created_at
+  FROM api_keys
+  WHERE user_id = $1
+  ORDER BY created_at DESC, id DESC
+  `
+
+	rows, err := s.db.Query(query, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	keys := []*APIKey{}
+	for rows.Next() {
+		var key APIKey
+		var permissions string
+		err = rows.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &permissions, &key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		key.Permissions = splitPermissions(permissions)
+		keys = append(keys, &key)
+	}
+
+	return keys, rows.Err()
+}
+
+func (s *PostgresAPIKeyStore) Delete(userId int, id int64) error {
+	query := `
+  DELETE FROM api_keys
+  WHERE id = $1 AND user_id = $2
+  `
+
+	result, err := s.db.Exec(query, id, userId)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (s *PostgresAPIKeyStore) Touch(plainText string, interval time.Duration) error {
+	query := `
+  UPDATE api_keys
+  SET last_used_at = NOW()
+  WHERE hash = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - $2 * INTERVAL '1 second')
+  `
+
+	_, err := s.db.Exec(query, tokens.Hash(plainText), interval.Seconds())
+	return err
+}
+
+func splitPermissions(permissions string) tokens.Permissions {
+	if permissions == "" {
+		return tokens.Permissions{}
+	}
+	return strings.Split(permissions, ",")
+}
@@ -0,0 +1,340 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	ExerciseTypeReps = "reps"
+	ExerciseTypeTime = "time"
+)
+
+const foreignKeyViolationCode = "23503"
+
+var (
+	ErrDuplicateExercise = errors.New("an exercise with this name already exists")
+	ErrUnknownExercise   = errors.New("exercise does not exist")
+	ErrAlreadyGlobal     = errors.New("exercise is already in the global catalog")
+)
+
+func IsValidExerciseType(exerciseType string) bool {
+	return exerciseType == ExerciseTypeReps || exerciseType == ExerciseTypeTime
+}
+
+// Exercise is either part of the global catalog, when OwnerID is nil, or a
+// private exercise only its owner can see and use.
+type Exercise struct {
+	ID           int       `json:"id"`
+	OwnerID      *int      `json:"owner_id"`
+	Name         string    `json:"name"`
+	Aliases      []string  `json:"aliases"`
+	MuscleGroups []string  `json:"muscle_groups"`
+	Equipment    []string  `json:"equipment"`
+	Type         string    `json:"type"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+type ExerciseFilter struct {
+	// UserID adds the user's private exercises to the global catalog.
+	UserID      int
+	Query       string
+	MuscleGroup string
+	Equipment   string
+	Type        string
+	Limit       int
+	Offset      int
+}
+
+type ExerciseStore interface {
+	Create(exercise *Exercise) (*Exercise, error)
+	GetByID(id int64) (*Exercise, error)
+	Search(filter ExerciseFilter) ([]*Exercise, error)
+	Update(exercise *Exercise) error
+	Delete(id int64) error
+	GetExerciseOwner(id int64) (*int, error)
+	Promote(id int64) (*Exercise, int64, error)
+	Seed(fsys fs.FS, name string) (int64, error)
+}
+
+type PostgresExerciseStore struct {
+	db *sql.DB
+}
+
+func NewPostgresExerciseStore(db *sql.DB) *PostgresExerciseStore {
+	return &PostgresExerciseStore{db: db}
+}
+
+func translateExerciseError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode && (pgErr.ConstraintName == "idx_exercises_global_name" || pgErr.ConstraintName == "idx_exercises_owner_name") {
+		return ErrDuplicateExercise
+	}
+	return err
+}
+
+const exerciseColumns = `id, owner_id, name, to_json(aliases), to_json(muscle_groups), to_json(equipment), type, created_at, updated_at`
+
+func scanExercise(row scanner) (*Exercise, error) {
+	var exercise Exercise
+	var aliases, muscleGroups, equipment []byte
+	err := row.Scan(&exercise.ID, &exercise.OwnerID, &exercise.Name, &aliases, &muscleGroups, &equipment, &exercise.Type, &exercise.CreatedAt, &exercise.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, column := range []struct {
+		data   []byte
+		target *[]string
+	}{
+		{aliases, &exercise.Aliases},
+		{muscleGroups, &exercise.MuscleGroups},
+		{equipment, &exercise.Equipment},
+	} {
+		if err := json.Unmarshal(column.data, column.target); err != nil {
+			return nil, err
+		}
+	}
+
+	return &exercise, nil
+}
+
+// nonNil keeps empty lists from being stored as NULL.
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+func (pg *PostgresExerciseStore) Create(exercise *Exercise) (*Exercise, error) {
+	query := `
+  INSERT INTO exercises (owner_id, name, aliases, muscle_groups, equipment, type)
+  VALUES ($1, $2, $3, $4, $5, $6)
+  RETURNING id, created_at, updated_at
+  `
+
+	err := pg.db.QueryRow(query, exercise.OwnerID, exercise.Name, nonNil(exercise.Aliases), nonNil(exercise.MuscleGroups), nonNil(exercise.Equipment), exercise.Type).Scan(&exercise.ID, &exercise.CreatedAt, &exercise.UpdatedAt)
+	if err != nil {
+		return nil, translateExerciseError(err)
+	}
+
+	return exercise, nil
+}
+
+func (pg *PostgresExerciseStore) GetByID(id int64) (*Exercise, error) {
+	query := fmt.Sprintf(`
+  SELECT %s
+  FROM exercises
+  WHERE id = $1
+  `, exerciseColumns)
+
+	exercise, err := scanExercise(pg.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return exercise, err
+}
+
+// Search lists exercises whose name or aliases look like filter.Query, best
+// matches first. Without a query every exercise is listed by name.
+func (pg *PostgresExerciseStore) Search(filter ExerciseFilter) ([]*Exercise, error) {
+	query := fmt.Sprintf(`
+  SELECT %s
+  FROM (
+    SELECT e.*, GREATEST(
+      similarity(e.name, $1),
+      COALESCE((SELECT MAX(similarity(a, $1)) FROM unnest(e.aliases) a), 0)
+    ) AS score
+    FROM exercises e
+  ) exercises
+  WHERE ($1 = ''
+      OR name ILIKE '%%' || $2 || '%%'
+      OR EXISTS (SELECT 1 FROM unnest(aliases) a WHERE a ILIKE '%%' || $2 || '%%')
+      OR score >= 0.3)
+    AND ($3 = '' OR $3 = ANY(muscle_groups))
+    AND ($4 = '' OR $4 = ANY(equipment))
+    AND ($5 = '' OR type = $5)
+    AND (owner_id IS NULL OR owner_id = $8)
+  ORDER BY score DESC, name
+  LIMIT $6 OFFSET $7
+  `, exerciseColumns)
+
+	rows, err := pg.db.Query(query, filter.Query, escapeLike(filter.Query), strings.ToLower(filter.MuscleGroup), strings.ToLower(filter.Equipment), filter.Type, filter.Limit, filter.Offset, filter.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	exercises := []*Exercise{}
+	for rows.Next() {
+		exercise, err := scanExercise(rows)
+		if err != nil {
+			return nil, err
+		}
+		exercises = append(exercises, exercise)
+	}
+
+	return exercises, rows.Err()
+}
+
+func (pg *PostgresExerciseStore) Update(exercise *Exercise) error {
+	query := `
+  UPDATE exercises
+  SET name = $1, aliases = $2, muscle_groups = $3, equipment = $4, type = $5, updated_at = NOW()
+  WHERE id = $6
+  RETURNING updated_at
+  `
+
+	err := pg.db.QueryRow(query, exercise.Name, nonNil(exercise.Aliases), nonNil(exercise.MuscleGroups), nonNil(exercise.Equipment), exercise.Type, exercise.ID).Scan(&exercise.UpdatedAt)
+	return translateExerciseError(err)
+}
+
+// Delete removes an exercise. Entries that referenced it keep their name, and
+// revisions that did drop it when they are read back.
+func (pg *PostgresExerciseStore) Delete(id int64) error {
+	result, err := pg.db.Exec("DELETE FROM exercises WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// GetExerciseOwner returns the owner of a private exercise and nil for a
+// global one.
+func (pg *PostgresExerciseStore) GetExerciseOwner(id int64) (*int, error) {
+	var ownerID *int
+	err := pg.db.QueryRow("SELECT owner_id FROM exercises WHERE id = $1", id).Scan(&ownerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return ownerID, nil
+}
+
+// Promote moves a private exercise to the global catalog. When the catalog
+// already has an exercise with that name, entries and revisions are remapped
+// to it and the private one is removed. It returns the global exercise and how many entries
+// were remapped.
+func (pg *PostgresExerciseStore) Promote(id int64) (*Exercise, int64, error) {
+	tx, err := pg.db.Begin()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer tx.Rollback()
+
+	exercise, err := scanExercise(tx.QueryRow(fmt.Sprintf("SELECT %s FROM exercises WHERE id = $1 FOR UPDATE", exerciseColumns), id))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if exercise.OwnerID == nil {
+		return nil, 0, ErrAlreadyGlobal
+	}
+
+	global, err := scanExercise(tx.QueryRow(fmt.Sprintf("SELECT %s FROM exercises WHERE owner_id IS NULL AND LOWER(name) = LOWER($1) FOR UPDATE", exerciseColumns), exercise.Name))
+	if err == sql.ErrNoRows {
+		err = tx.QueryRow("UPDATE exercises SET owner_id = NULL, updated_at = NOW() WHERE id = $1 RETURNING updated_at", id).Scan(&exercise.UpdatedAt)
+		if err != nil {
+			return nil, 0, translateExerciseError(err)
+		}
+		exercise.OwnerID = nil
+		return exercise, 0, tx.Commit()
+	}
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	result, err := tx.Exec("UPDATE workout_entries SET exercise_id = $1, updated_at = NOW() WHERE exercise_id = $2", global.ID, id)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	remapped, err := result.RowsAffected()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// revisions are restored through checkExercises, which would refuse the
+	// private exercise once it's gone
+	_, err = tx.Exec(`
+  UPDATE workout_revisions
+  SET snapshot = jsonb_set(snapshot, '{entries}', (
+    SELECT jsonb_agg(
+      CASE WHEN entry->'exercise_id' = to_jsonb($2::BIGINT) THEN jsonb_set(entry, '{exercise_id}', to_jsonb($1::BIGINT)) ELSE entry END
+      ORDER BY position
+    )
+    FROM jsonb_array_elements(snapshot->'entries') WITH ORDINALITY AS entries(entry, position)
+  ))
+  WHERE snapshot->'entries' @> jsonb_build_array(jsonb_build_object('exercise_id', $2::BIGINT))
+  `, global.ID, id)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	_, err = tx.Exec("DELETE FROM exercises WHERE id = $1", id)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return global, remapped, tx.Commit()
+}
+
+// Seed adds the exercises listed in the JSON file name of fsys that aren't in
+// the catalog yet. Exercises already there are left as they are.
+func (pg *PostgresExerciseStore) Seed(fsys fs.FS, name string) (int64, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return 0, err
+	}
+
+	var exercises []Exercise
+	err = json.Unmarshal(data, &exercises)
+	if err != nil {
+		return 0, fmt.Errorf("parse %s: %w", name, err)
+	}
+
+	query := `
+  INSERT INTO exercises (name, aliases, muscle_groups, equipment, type)
+  VALUES ($1, $2, $3, $4, $5)
+  ON CONFLICT ((LOWER(name))) WHERE owner_id IS NULL DO NOTHING
+  `
+
+	var seeded int64
+	for _, exercise := range exercises {
+		result, err := pg.db.Exec(query, exercise.Name, nonNil(exercise.Aliases), nonNil(exercise.MuscleGroups), nonNil(exercise.Equipment), exercise.Type)
+		if err != nil {
+			return seeded, fmt.Errorf("seed exercise %q: %w", exercise.Name, err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return seeded, err
+		}
+		seeded += rowsAffected
+	}
+
+	return seeded, nil
+}
@@ -0,0 +1,164 @@
+package store
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupExerciseTest(t *testing.T) (*sql.DB, *User, *User) {
+	db := setupTestDB(t)
+	_, err := db.Exec("TRUNCATE TABLE users RESTART IDENTITY CASCADE")
+	require.NoError(t, err)
+	_, err = db.Exec("DELETE FROM exercises WHERE name LIKE 'Test %'")
+	require.NoError(t, err)
+
+	return db, createTestUser(t, db, "owner"), createTestUser(t, db, "other")
+}
+
+func createTestExercise(t *testing.T, db *sql.DB, owner *User, name string) *Exercise {
+	exercise := &Exercise{Name: name, Type: ExerciseTypeReps}
+	if owner != nil {
+		exercise.OwnerID = &owner.ID
+	}
+	created, err := NewPostgresExerciseStore(db).Create(exercise)
+	require.NoError(t, err)
+	return created
+}
+
+func TestExerciseOwnerScoping(t *testing.T) {
+	db, owner, other := setupExerciseTest(t)
+	defer db.Close()
+	exerciseStore := NewPostgresExerciseStore(db)
+	workoutStore := NewPostgresWorkoutStore(db)
+
+	global := createTestExercise(t, db, nil, "Test Sled Push")
+	own := createTestExercise(t, db, owner, "Test Towel Row")
+	others := createTestExercise(t, db, other, "Test Door Curl")
+
+	found, err := exerciseStore.Search(ExerciseFilter{UserID: owner.ID, Query: "Test", Limit: 10})
+	require.NoError(t, err)
+	names := []string{}
+	for _, exercise := range found {
+		names = append(names, exercise.Name)
+	}
+	assert.Contains(t, names, global.Name)
+	assert.Contains(t, names, own.Name)
+	assert.NotContains(t, names, others.Name)
+
+	tests := []struct {
+		name     string
+		exercise *Exercise
+		wantErr  error
+	}{
+		{"global exercise", global, nil},
+		{"own private exercise", own, nil},
+		{"another user's private exercise", others, ErrUnknownExercise},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := workoutStore.Create(&Workout{
+				UserID:     owner.ID,
+				Title:      tt.name,
+				Visibility: VisibilityPrivate,
+				Entries: []WorkoutEntry{
+					{ExerciseID: &tt.exercise.ID, Sets: 3, Reps: IntPtr(10), OrderIndex: 1},
+				},
+			})
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestPromote(t *testing.T) {
+	db, owner, _ := setupExerciseTest(t)
+	defer db.Close()
+	exerciseStore := NewPostgresExerciseStore(db)
+	workoutStore := NewPostgresWorkoutStore(db)
+
+	t.Run("new to the catalog", func(t *testing.T) {
+		private := createTestExercise(t, db, owner, "Test Sandbag Carry")
+
+		promoted, remapped, err := exerciseStore.Promote(int64(private.ID))
+		require.NoError(t, err)
+		assert.Equal(t, private.ID, promoted.ID)
+		assert.Nil(t, promoted.OwnerID)
+		assert.Zero(t, remapped)
+
+		_, _, err = exerciseStore.Promote(int64(private.ID))
+		assert.ErrorIs(t, err, ErrAlreadyGlobal)
+	})
+
+	t.Run("merged into a catalog exercise", func(t *testing.T) {
+		global := createTestExercise(t, db, nil, "Test Sled Drag")
+		private := createTestExercise(t, db, owner, "test sled drag")
+
+		workout, err := workoutStore.Create(&Workout{
+			UserID:     owner.ID,
+			Title:      "Conditioning",
+			Visibility: VisibilityPrivate,
+			Entries: []WorkoutEntry{
+				{ExerciseID: &private.ID, Sets: 3, Reps: IntPtr(20), OrderIndex: 1},
+			},
+		})
+		require.NoError(t, err)
+
+		workout.Title = "Conditioning day"
+		require.NoError(t, workoutStore.Update(workout))
+
+		promoted, remapped, err := exerciseStore.Promote(int64(private.ID))
+		require.NoError(t, err)
+		assert.Equal(t, global.ID, promoted.ID)
+		assert.Equal(t, int64(1), remapped)
+
+		stored, err := workoutStore.GetByID(int64(workout.ID))
+		require.NoError(t, err)
+		require.NotNil(t, stored.Entries[0].ExerciseID)
+		assert.Equal(t, global.ID, *stored.Entries[0].ExerciseID)
+
+		revision, err := workoutStore.GetRevision(int64(workout.ID), 1)
+		require.NoError(t, err)
+		require.NotNil(t, revision.Snapshot.Entries[0].ExerciseID)
+		assert.Equal(t, global.ID, *revision.Snapshot.Entries[0].ExerciseID)
+
+		stored.Title = revision.Snapshot.Title
+		stored.Entries = revision.Snapshot.Entries
+		assert.NoError(t, workoutStore.Update(stored))
+	})
+}
+
+func TestRevisionOfDeletedExercise(t *testing.T) {
+	db, owner, _ := setupExerciseTest(t)
+	defer db.Close()
+	workoutStore := NewPostgresWorkoutStore(db)
+
+	private := createTestExercise(t, db, owner, "Test Rope Pull")
+	workout, err := workoutStore.Create(&Workout{
+		UserID:     owner.ID,
+		Title:      "Back",
+		Visibility: VisibilityPrivate,
+		Entries: []WorkoutEntry{
+			{ExerciseID: &private.ID, Sets: 3, Reps: IntPtr(12), OrderIndex: 1},
+		},
+	})
+	require.NoError(t, err)
+
+	workout.Title = "Back day"
+	require.NoError(t, workoutStore.Update(workout))
+	require.NoError(t, NewPostgresExerciseStore(db).Delete(int64(private.ID)))
+
+	revision, err := workoutStore.GetRevision(int64(workout.ID), 1)
+	require.NoError(t, err)
+	assert.Nil(t, revision.Snapshot.Entries[0].ExerciseID)
+	assert.Equal(t, private.Name, revision.Snapshot.Entries[0].ExerciseName)
+
+	workout.Entries = revision.Snapshot.Entries
+	assert.NoError(t, workoutStore.Update(workout))
+}
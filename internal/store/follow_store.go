@@ -0,0 +1,66 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type FollowStore interface {
+	Follow(followerID, followeeID int) error
+	Unfollow(followerID, followeeID int) error
+	IsFollowing(followerID, followeeID int) (bool, error)
+}
+
+type PostgresFollowStore struct {
+	db *sql.DB
+}
+
+func NewPostgresFollowStore(db *sql.DB) *PostgresFollowStore {
+	return &PostgresFollowStore{db}
+}
+
+// Follow makes followerID a follower of followeeID. Following someone twice
+// is not an error. It returns sql.ErrNoRows when the followee doesn't exist.
+func (s *PostgresFollowStore) Follow(followerID, followeeID int) error {
+	query := `
+  INSERT INTO follows (follower_id, followee_id)
+  VALUES ($1, $2)
+  ON CONFLICT DO NOTHING
+  `
+
+	_, err := s.db.Exec(query, followerID, followeeID)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolationCode {
+		return sql.ErrNoRows
+	}
+
+	return err
+}
+
+// Unfollow stops followerID from following followeeID. Unfollowing someone
+// who isn't followed is not an error.
+func (s *PostgresFollowStore) Unfollow(followerID, followeeID int) error {
+	_, err := s.db.Exec("DELETE FROM follows WHERE follower_id = $1 AND followee_id = $2", followerID, followeeID)
+	return err
+}
+
+func (s *PostgresFollowStore) IsFollowing(followerID, followeeID int) (bool, error) {
+	var exists bool
+
+	query := `
+  SELECT EXISTS (
+    SELECT 1
+    FROM follows
+    WHERE follower_id = $1 AND followee_id = $2
+  )
+  `
+
+	err := s.db.QueryRow(query, followerID, followeeID).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
@@ -0,0 +1,81 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+type LoginAttemptStore interface {
+	LockedUntil(keys []string, now time.Time) (*time.Time, error)
+	RecordFailure(key string, now time.Time, window time.Duration) (int, error)
+	Lock(key string, until time.Time) error
+	Reset(key string) error
+}
+
+type PostgresLoginAttemptStore struct {
+	db *sql.DB
+}
+
+func NewPostgresLoginAttemptStore(db *sql.DB) *PostgresLoginAttemptStore {
+	return &PostgresLoginAttemptStore{db}
+}
+
+// LockedUntil returns the latest lockout still in effect for any of keys, or
+// nil when none of them is locked.
+func (s *PostgresLoginAttemptStore) LockedUntil(keys []string, now time.Time) (*time.Time, error) {
+	var lockedUntil *time.Time
+
+	query := `
+  SELECT MAX(locked_until)
+  FROM login_attempts
+  WHERE key = ANY($1) AND locked_until > $2
+  `
+
+	err := s.db.QueryRow(query, keys, now).Scan(&lockedUntil)
+	if err != nil {
+		return nil, err
+	}
+
+	return lockedUntil, nil
+}
+
+// RecordFailure counts a failed attempt and returns the number of failures in
+// the current window. Failures older than window start the count over.
+func (s *PostgresLoginAttemptStore) RecordFailure(key string, now time.Time, window time.Duration) (int, error) {
+	var failures int
+
+	query := `
+  INSERT INTO login_attempts (key, failures, last_failure_at)
+  VALUES ($1, 1, $2)
+  ON CONFLICT (key) DO UPDATE
+  SET failures = CASE
+      WHEN login_attempts.last_failure_at < $3 THEN 1
+      ELSE login_attempts.failures + 1
+    END,
+    last_failure_at = EXCLUDED.last_failure_at
+  RETURNING failures
+  `
+
+	err := s.db.QueryRow(query, key, now, now.Add(-window)).Scan(&failures)
+	if err != nil {
+		return 0, err
+	}
+
+	return failures, nil
+}
+
+func (s *PostgresLoginAttemptStore) Lock(key string, until time.Time) error {
+	query := `
+  UPDATE login_attempts
+  SET locked_until = $2
+  WHERE key = $1
+  `
+
+	_, err := s.db.Exec(query, key, until)
+	return err
+}
+
+func (s *PostgresLoginAttemptStore) Reset(key string) error {
+	_, err := s.db.Exec("DELETE FROM login_attempts WHERE key = $1", key)
+	return err
+}
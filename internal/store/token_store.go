@@ -1,16 +1,39 @@
 package store
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/joao-vitor-felix/workout-api/internal/tokens"
 )
 
+var (
+	ErrInvalidToken = errors.New("invalid or expired token")
+	ErrTokenReused  = errors.New("refresh token reused")
+)
+
+type Session struct {
+	ID          int        `json:"id"`
+	DeviceLabel string     `json:"device_label"`
+	UserAgent   string     `json:"user_agent"`
+	IPAddress   string     `json:"ip_address"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	Current     bool       `json:"current"`
+}
+
 type TokenStore interface {
 	Insert(token *tokens.Token) error
 	Create(userId int, ttl time.Duration, scope string) (*tokens.Token, error)
+	Delete(plainText string) error
 	DeleteForUser(userId int, scope string) error
+	Touch(plainText string, interval time.Duration) error
+	ListSessions(userId int, currentPlainText string) ([]*Session, error)
+	DeleteSession(userId int, sessionId int64) error
+	Rotate(refreshPlainText string, accessTTL, refreshTTL time.Duration, userAgent, ipAddress string) (*tokens.Token, *tokens.Token, error)
 }
 
 type PostgresTokenStore struct {
@@ -21,11 +44,19 @@ func NewPostgresTokenStore(db *sql.DB) *PostgresTokenStore {
 	return &PostgresTokenStore{db}
 }
 
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
 func (t *PostgresTokenStore) Insert(token *tokens.Token) error {
+	return insertToken(t.db, token)
+}
+
+func insertToken(db execer, token *tokens.Token) error {
 	query := `
-		INSERT INTO tokens (hash, user_id, scope, expires_at)
-		VALUES ($1, $2, $3, $4)`
-	_, err := t.db.Exec(query, token.Hash, token.UserID, token.Scope, token.ExpiresAt)
+		INSERT INTO tokens (hash, user_id, scope, expires_at, device_label, user_agent, ip_address, family_id)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), NULLIF($8, ''))`
+	_, err := db.Exec(query, token.Hash, token.UserID, token.Scope, token.ExpiresAt, token.DeviceLabel, token.UserAgent, token.IPAddress, token.FamilyID)
 	return err
 }
 
@@ -41,6 +72,17 @@ func (t *PostgresTokenStore) Create(userId int, ttl time.Duration, scope string)
 	return token, nil
 }
 
+// Delete revokes a token together with every other token of its family.
+func (t *PostgresTokenStore) Delete(plainText string) error {
+	tokenHash := sha256.Sum256([]byte(plainText))
+	query := `
+		DELETE FROM tokens
+		WHERE hash = $1
+		OR family_id = (SELECT family_id FROM tokens WHERE hash = $1)`
+	_, err := t.db.Exec(query, tokenHash[:])
+	return err
+}
+
 func (t *PostgresTokenStore) DeleteForUser(userId int, scope string) error {
 	query := `
 		DELETE FROM tokens
@@ -48,3 +90,161 @@ func (t *PostgresTokenStore) DeleteForUser(userId int, scope string) error {
 	_, err := t.db.Exec(query, userId, scope)
 	return err
 }
+
+// Touch records that a token was used, skipping the write when it was already
+// recorded less than interval ago.
+func (t *PostgresTokenStore) Touch(plainText string, interval time.Duration) error {
+	tokenHash := sha256.Sum256([]byte(plainText))
+	query := `
+		UPDATE tokens
+		SET last_used_at = NOW()
+		WHERE hash = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - $2 * INTERVAL '1 second')`
+	_, err := t.db.Exec(query, tokenHash[:], interval.Seconds())
+	return err
+}
+
+func (t *PostgresTokenStore) ListSessions(userId int, currentPlainText string) ([]*Session, error) {
+	currentHash := sha256.Sum256([]byte(currentPlainText))
+	// tokens issued by refreshing the same sign-in share a family and are
+	// reported as a single session, represented by the newest token
+	query := `
+		SELECT id, device_label, user_agent, ip_address, created_at, last_used_at, expires_at, current
+		FROM (
+			SELECT DISTINCT ON (session_key)
+				id, COALESCE(device_label, '') AS device_label, COALESCE(user_agent, '') AS user_agent,
+				COALESCE(ip_address, '') AS ip_address, created_at, last_used_at, expires_at,
+				bool_or(hash = $3) OVER (PARTITION BY session_key) AS current
+			FROM (
+				SELECT *, COALESCE(family_id, encode(hash, 'hex')) AS session_key
+				FROM tokens
+				WHERE user_id = $1 AND scope = $2 AND expires_at > $4
+			) t
+			ORDER BY session_key, created_at DESC
+		) s
+		ORDER BY COALESCE(last_used_at, created_at) DESC`
+
+	rows, err := t.db.Query(query, userId, tokens.ScopeAuth, currentHash[:], time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		var session Session
+		err = rows.Scan(&session.ID, &session.DeviceLabel, &session.UserAgent, &session.IPAddress,
+			&session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt, &session.Current)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &session)
+	}
+
+	return sessions, rows.Err()
+}
+
+func (t *PostgresTokenStore) DeleteSession(userId int, sessionId int64) error {
+	query := `
+		DELETE FROM tokens
+		WHERE user_id = $2
+		AND (
+			(id = $1 AND scope = $3)
+			OR family_id = (SELECT family_id FROM tokens WHERE id = $1 AND user_id = $2 AND scope = $3)
+		)`
+	result, err := t.db.Exec(query, sessionId, userId, tokens.ScopeAuth)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// Rotate exchanges a refresh token for a new access and refresh token pair of
+// the same family. Presenting an already used refresh token revokes the whole
+// family, since it means the token leaked.
+func (t *PostgresTokenStore) Rotate(refreshPlainText string, accessTTL, refreshTTL time.Duration, userAgent, ipAddress string) (*tokens.Token, *tokens.Token, error) {
+	tx, err := t.db.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer tx.Rollback()
+
+	tokenHash := sha256.Sum256([]byte(refreshPlainText))
+	query := `
+		SELECT user_id, COALESCE(family_id, ''), COALESCE(device_label, ''), expires_at, used_at
+		FROM tokens
+		WHERE hash = $1 AND scope = $2
+		FOR UPDATE`
+
+	var userId int
+	var familyId, deviceLabel string
+	var expiresAt time.Time
+	var usedAt *time.Time
+	err = tx.QueryRow(query, tokenHash[:], tokens.ScopeRefresh).Scan(&userId, &familyId, &deviceLabel, &expiresAt, &usedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if usedAt != nil {
+		_, err = tx.Exec("DELETE FROM tokens WHERE family_id = $1", familyId)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err = tx.Commit(); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrTokenReused
+	}
+
+	if !expiresAt.After(time.Now()) {
+		return nil, nil, ErrInvalidToken
+	}
+
+	_, err = tx.Exec("UPDATE tokens SET used_at = NOW() WHERE hash = $1", tokenHash[:])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	issued := make([]*tokens.Token, 0, 2)
+	for _, spec := range []struct {
+		ttl   time.Duration
+		scope string
+	}{
+		{accessTTL, tokens.ScopeAuth},
+		{refreshTTL, tokens.ScopeRefresh},
+	} {
+		token, err := tokens.GenerateToken(userId, spec.ttl, spec.scope)
+		if err != nil {
+			return nil, nil, err
+		}
+		token.FamilyID = familyId
+		token.DeviceLabel = deviceLabel
+		token.UserAgent = userAgent
+		token.IPAddress = ipAddress
+
+		if err = insertToken(tx, token); err != nil {
+			return nil, nil, err
+		}
+		issued = append(issued, token)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	return issued[0], issued[1], nil
+}
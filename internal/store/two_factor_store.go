@@ -0,0 +1,204 @@
+package store
+
+import (
+	"database/sql"
+	"time"
+)
+
+type TwoFactor struct {
+	Secret    string
+	EnabledAt *time.Time
+}
+
+type TwoFactorStore interface {
+	Get(userId int) (*TwoFactor, error)
+	SetPendingSecret(userId int, secret string) error
+	Enable(userId int, recoveryCodes []string) error
+	Disable(userId int) error
+	UseStep(userId int, step int64) (bool, error)
+	UseRecoveryCode(userId int, code string) (bool, error)
+}
+
+type PostgresTwoFactorStore struct {
+	db *sql.DB
+}
+
+func NewPostgresTwoFactorStore(db *sql.DB) *PostgresTwoFactorStore {
+	return &PostgresTwoFactorStore{db}
+}
+
+func (s *PostgresTwoFactorStore) Get(userId int) (*TwoFactor, error) {
+	var secret sql.NullString
+	twoFactor := &TwoFactor{}
+
+	query := `
+  SELECT totp_secret, totp_enabled_at
+  FROM users
+  WHERE id = $1
+  `
+
+	err := s.db.QueryRow(query, userId).Scan(&secret, &twoFactor.EnabledAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !secret.Valid {
+		return nil, nil
+	}
+
+	twoFactor.Secret = secret.String
+	return twoFactor, nil
+}
+
+// SetPendingSecret stores a secret that only takes effect once Enable is called.
+func (s *PostgresTwoFactorStore) SetPendingSecret(userId int, secret string) error {
+	query := `
+  UPDATE users
+  SET totp_secret = $2, totp_enabled_at = NULL, totp_last_step = NULL
+  WHERE id = $1
+  `
+
+	_, err := s.db.Exec(query, userId, secret)
+	return err
+}
+
+func (s *PostgresTwoFactorStore) Enable(userId int, recoveryCodes []string) error {
+	hashes := make([]password, len(recoveryCodes))
+	for i, code := range recoveryCodes {
+		if err := hashes[i].Set(code); err != nil {
+			return err
+		}
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE users SET totp_enabled_at = NOW() WHERE id = $1", userId)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM recovery_codes WHERE user_id = $1", userId)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range hashes {
+		_, err = tx.Exec("INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)", userId, hash.hash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *PostgresTwoFactorStore) Disable(userId int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	query := `
+  UPDATE users
+  SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL
+  WHERE id = $1
+  `
+
+	_, err = tx.Exec(query, userId)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM recovery_codes WHERE user_id = $1", userId)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseStep records step as the last accepted TOTP period and reports false
+// when it, or a later one, was already used.
+func (s *PostgresTwoFactorStore) UseStep(userId int, step int64) (bool, error) {
+	query := `
+  UPDATE users
+  SET totp_last_step = $2
+  WHERE id = $1 AND (totp_last_step IS NULL OR totp_last_step < $2)
+  `
+
+	result, err := s.db.Exec(query, userId, step)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
+
+func (s *PostgresTwoFactorStore) UseRecoveryCode(userId int, code string) (bool, error) {
+	query := `
+  SELECT id, code_hash
+  FROM recovery_codes
+  WHERE user_id = $1 AND used_at IS NULL
+  `
+
+	rows, err := s.db.Query(query, userId)
+	if err != nil {
+		return false, err
+	}
+
+	defer rows.Close()
+
+	var matchedId int64
+	for rows.Next() {
+		var id int64
+		var hash password
+		if err = rows.Scan(&id, &hash.hash); err != nil {
+			return false, err
+		}
+
+		matches, err := hash.Check(code)
+		if err != nil {
+			return false, err
+		}
+		if matches {
+			matchedId = id
+			break
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return false, err
+	}
+
+	if matchedId == 0 {
+		return false, nil
+	}
+
+	result, err := s.db.Exec("UPDATE recovery_codes SET used_at = NOW() WHERE id = $1 AND used_at IS NULL", matchedId)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
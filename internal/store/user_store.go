@@ -6,9 +6,34 @@ import (
 	"errors"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/joao-vitor-felix/workout-api/internal/tokens"
 	"golang.org/x/crypto/bcrypt"
 )
 
+var (
+	ErrDuplicateEmail    = errors.New("email already in use")
+	ErrDuplicateUsername = errors.New("username already taken")
+)
+
+const uniqueViolationCode = "23505"
+
+// translateUserError maps unique violations on the users table to typed errors.
+func translateUserError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != uniqueViolationCode {
+		return err
+	}
+
+	switch pgErr.ConstraintName {
+	case "users_email_key":
+		return ErrDuplicateEmail
+	case "users_username_key":
+		return ErrDuplicateUsername
+	}
+	return err
+}
+
 type password struct {
 	plainText *string
 	hash      []byte
@@ -38,14 +63,41 @@ func (p *password) Check(plainText string) (bool, error) {
 	return true, nil
 }
 
+// dummyPasswordHash is compared against when a sign-in names an unknown user,
+// so that the response takes as long as for a real account.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+func CheckDummyPassword(plainText string) {
+	_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(plainText))
+}
+
+const (
+	RoleUser  = "user"
+	RoleCoach = "coach"
+	RoleAdmin = "admin"
+)
+
+func IsValidRole(role string) bool {
+	switch role {
+	case RoleUser, RoleCoach, RoleAdmin:
+		return true
+	}
+	return false
+}
+
 type User struct {
-	ID           int       `json:"id"`
-	Email        string    `json:"email"`
-	Username     string    `json:"username"`
-	PasswordHash password  `json:"-"`
-	Bio          string    `json:"bio"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID               int        `json:"id"`
+	Email            string     `json:"email"`
+	Username         string     `json:"username"`
+	PasswordHash     password   `json:"-"`
+	Bio              string     `json:"bio"`
+	EmailVerifiedAt  *time.Time `json:"email_verified_at"`
+	TwoFactorEnabled bool       `json:"two_factor_enabled"`
+	Role             string     `json:"role"`
+	Units            string     `json:"units"`
+	DisabledAt       *time.Time `json:"disabled_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
 }
 
 var AnonymousUser = &User{}
@@ -54,11 +106,35 @@ func (u *User) IsAnonymous() bool {
 	return u == AnonymousUser
 }
 
+func (u *User) IsDisabled() bool {
+	return u.DisabledAt != nil
+}
+
+func (u *User) HasRole(roles ...string) bool {
+	for _, role := range roles {
+		if u.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *User) IsVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
 type UserStore interface {
 	Create(user *User) (*User, error)
 	GetByUsername(username string) (*User, error)
+	GetByEmail(email string) (*User, error)
+	GetByID(id int64) (*User, error)
+	Search(query string, limit, offset int) ([]*User, error)
+	SetRole(id int64, role string) error
+	SetDisabled(id int64, disabled bool) error
+	Delete(id int) error
 	Update(*User) (*User, error)
 	GetUserToken(scope, tokenPlainText string) (*User, error)
+	GetUserAPIKey(keyPlainText string) (*User, tokens.Permissions, error)
 }
 
 type PostgresUserStore struct {
@@ -71,15 +147,15 @@ func NewPostgresUserStore(db *sql.DB) *PostgresUserStore {
 
 func (s *PostgresUserStore) Create(user *User) (*User, error) {
 	query := `
-    INSERT INTO users (email, username, password_hash, bio)
-    VALUES ($1, $2, $3, $4)
-    RETURNING id, created_at, updated_at
+    INSERT INTO users (email, username, password_hash, bio, units)
+    VALUES ($1, $2, $3, $4, COALESCE(NULLIF($5, ''), 'metric'))
+    RETURNING id, role, units, created_at, updated_at
   `
 
-	err := s.db.QueryRow(query, user.Email, user.Username, user.PasswordHash.hash, user.Bio).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+	err := s.db.QueryRow(query, user.Email, user.Username, user.PasswordHash.hash, user.Bio, user.Units).Scan(&user.ID, &user.Role, &user.Units, &user.CreatedAt, &user.UpdatedAt)
 
 	if err != nil {
-		return nil, err
+		return nil, translateUserError(err)
 	}
 
 	return user, nil
@@ -92,12 +168,59 @@ func (s *PostgresUserStore) GetByUsername(username string) (*User, error) {
 	}
 
 	query := `
-  SELECT id, email, password_hash, bio, created_at, updated_at
+  SELECT id, email, password_hash, bio, email_verified_at, totp_enabled_at IS NOT NULL, role, units, disabled_at, created_at, updated_at
   FROM users
   WHERE username = $1
   `
 
-	err := s.db.QueryRow(query, username).Scan(&user.ID, &user.Email, &user.PasswordHash.hash, &user.Bio, &user.CreatedAt, &user.UpdatedAt)
+	err := s.db.QueryRow(query, username).Scan(&user.ID, &user.Email, &user.PasswordHash.hash, &user.Bio, &user.EmailVerifiedAt, &user.TwoFactorEnabled, &user.Role, &user.Units, &user.DisabledAt, &user.CreatedAt, &user.UpdatedAt)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *PostgresUserStore) GetByEmail(email string) (*User, error) {
+	user := &User{
+		Email:        email,
+		PasswordHash: password{},
+	}
+
+	query := `
+  SELECT id, username, password_hash, bio, email_verified_at, totp_enabled_at IS NOT NULL, role, units, disabled_at, created_at, updated_at
+  FROM users
+  WHERE email = $1
+  `
+
+	err := s.db.QueryRow(query, email).Scan(&user.ID, &user.Username, &user.PasswordHash.hash, &user.Bio, &user.EmailVerifiedAt, &user.TwoFactorEnabled, &user.Role, &user.Units, &user.DisabledAt, &user.CreatedAt, &user.UpdatedAt)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *PostgresUserStore) GetByID(id int64) (*User, error) {
+	user := &User{
+		PasswordHash: password{},
+	}
+
+	query := `
+  SELECT id, username, email, password_hash, bio, email_verified_at, totp_enabled_at IS NOT NULL, role, units, disabled_at, created_at, updated_at
+  FROM users
+  WHERE id = $1
+  `
+
+	err := s.db.QueryRow(query, id).Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash.hash, &user.Bio, &user.EmailVerifiedAt, &user.TwoFactorEnabled, &user.Role, &user.Units, &user.DisabledAt, &user.CreatedAt, &user.UpdatedAt)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -109,21 +232,114 @@ func (s *PostgresUserStore) GetByUsername(username string) (*User, error) {
 	return user, nil
 }
 
+// Search matches query against usernames and emails. An empty query lists
+// every user.
+func (s *PostgresUserStore) Search(query string, limit, offset int) ([]*User, error) {
+	sqlQuery := `
+  SELECT id, username, email, bio, email_verified_at, totp_enabled_at IS NOT NULL, role, units, disabled_at, created_at, updated_at
+  FROM users
+  WHERE $1 = '' OR username ILIKE '%' || $1 || '%' OR email ILIKE '%' || $1 || '%'
+  ORDER BY id
+  LIMIT $2 OFFSET $3
+  `
+
+	rows, err := s.db.Query(sqlQuery, escapeLike(query), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	users := []*User{}
+	for rows.Next() {
+		var user User
+		err = rows.Scan(&user.ID, &user.Username, &user.Email, &user.Bio, &user.EmailVerifiedAt, &user.TwoFactorEnabled, &user.Role, &user.Units, &user.DisabledAt, &user.CreatedAt, &user.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, &user)
+	}
+
+	return users, rows.Err()
+}
+
+func (s *PostgresUserStore) SetRole(id int64, role string) error {
+	result, err := s.db.Exec("UPDATE users SET role = $2, updated_at = NOW() WHERE id = $1", id, role)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+func (s *PostgresUserStore) SetDisabled(id int64, disabled bool) error {
+	query := `
+    UPDATE users
+    SET disabled_at = CASE WHEN $2 THEN COALESCE(disabled_at, NOW()) END, updated_at = NOW()
+    WHERE id = $1
+  `
+
+	result, err := s.db.Exec(query, id, disabled)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
+// Delete removes a user. Workouts, tokens and every other row owned by the
+// user go with it through ON DELETE CASCADE.
+func (s *PostgresUserStore) Delete(id int) error {
+	result, err := s.db.Exec("DELETE FROM users WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
 func (s *PostgresUserStore) Update(user *User) (*User, error) {
 	query := `
     UPDATE users
-    SET email = $1, username = $2, password_hash = $3, bio = $4, updated_at = NOW()
-    WHERE id = $5
+    SET email = $1, username = $2, password_hash = $3, bio = $4, email_verified_at = $5, units = $7, updated_at = NOW()
+    WHERE id = $6
     RETURNING updated_at
   `
 
-	err := s.db.QueryRow(query, user.Email, user.Username, user.PasswordHash.hash, user.Bio, user.ID).Scan(&user.UpdatedAt)
+	err := s.db.QueryRow(query, user.Email, user.Username, user.PasswordHash.hash, user.Bio, user.EmailVerifiedAt, user.ID, user.Units).Scan(&user.UpdatedAt)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
-		return nil, err
+		return nil, translateUserError(err)
 	}
 
 	return user, nil
@@ -139,6 +355,10 @@ func (s *PostgresUserStore) GetUserToken(scope, plaintextPassword string) (*User
     u.email,
     u.password_hash,
     u.bio,
+    u.email_verified_at,
+    u.totp_enabled_at IS NOT NULL,
+    u.role,
+    u.units,
     u.created_at,
     u.updated_at
   FROM
@@ -149,6 +369,8 @@ func (s *PostgresUserStore) GetUserToken(scope, plaintextPassword string) (*User
     t.hash = $1
   AND
     t.scope = $2 and t.expires_at > $3
+  AND
+    u.disabled_at IS NULL
   `
 
 	user := &User{
@@ -161,6 +383,10 @@ func (s *PostgresUserStore) GetUserToken(scope, plaintextPassword string) (*User
 		&user.Email,
 		&user.PasswordHash.hash,
 		&user.Bio,
+		&user.EmailVerifiedAt,
+		&user.TwoFactorEnabled,
+		&user.Role,
+		&user.Units,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -175,3 +401,61 @@ func (s *PostgresUserStore) GetUserToken(scope, plaintextPassword string) (*User
 
 	return user, nil
 }
+
+func (s *PostgresUserStore) GetUserAPIKey(keyPlainText string) (*User, tokens.Permissions, error) {
+	query := `
+  SELECT
+    u.id,
+    u.username,
+    u.email,
+    u.password_hash,
+    u.bio,
+    u.email_verified_at,
+    u.totp_enabled_at IS NOT NULL,
+    u.role,
+    u.units,
+    u.created_at,
+    u.updated_at,
+    array_to_string(k.permissions, ',')
+  FROM
+    users u
+  INNER JOIN
+    api_keys k ON k.user_id = u.id
+  WHERE
+    k.hash = $1
+  AND
+    (k.expires_at IS NULL OR k.expires_at > $2)
+  AND
+    u.disabled_at IS NULL
+  `
+
+	user := &User{
+		PasswordHash: password{},
+	}
+	var permissions string
+
+	err := s.db.QueryRow(query, tokens.Hash(keyPlainText), time.Now()).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.PasswordHash.hash,
+		&user.Bio,
+		&user.EmailVerifiedAt,
+		&user.TwoFactorEnabled,
+		&user.Role,
+		&user.Units,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&permissions,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil, nil
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return user, splitPermissions(permissions), nil
+}
@@ -0,0 +1,158 @@
+package store
+
+import (
+	"database/sql"
+	"sort"
+)
+
+const (
+	GroupTypeSuperset = "superset"
+	GroupTypeCircuit  = "circuit"
+	GroupTypeEMOM     = "emom"
+	GroupTypeAMRAP    = "amrap"
+)
+
+func IsValidGroupType(groupType string) bool {
+	switch groupType {
+	case GroupTypeSuperset, GroupTypeCircuit, GroupTypeEMOM, GroupTypeAMRAP:
+		return true
+	}
+	return false
+}
+
+// WorkoutEntryGroup ties entries that are performed together, such as the A1
+// and A2 of a superset. Entries join a group by its label, which is unique
+// within the workout, so that new groups and entries can be created together.
+type WorkoutEntryGroup struct {
+	ID     int    `json:"id"`
+	Label  string `json:"label"`
+	Type   string `json:"type"`
+	Rounds int    `json:"rounds"`
+}
+
+// saveGroups makes the stored groups of a workout match workout.Groups and
+// fills in their IDs. Groups no entry belongs to are dropped.
+func saveGroups(tx *sql.Tx, workout *Workout) error {
+	used := make(map[string]bool, len(workout.Groups))
+	for _, entry := range workout.Entries {
+		if entry.Group != nil {
+			used[*entry.Group] = true
+		}
+	}
+
+	groups := make([]WorkoutEntryGroup, 0, len(used))
+	labels := make([]string, 0, len(used))
+	for _, group := range workout.Groups {
+		if !used[group.Label] {
+			continue
+		}
+		if group.Rounds == 0 {
+			group.Rounds = 1
+		}
+		groups = append(groups, group)
+		labels = append(labels, group.Label)
+	}
+
+	_, err := tx.Exec("DELETE FROM workout_entry_groups WHERE workout_id = $1 AND NOT (label = ANY($2))", workout.ID, labels)
+	if err != nil {
+		return err
+	}
+
+	query := `
+  INSERT INTO workout_entry_groups (workout_id, label, group_type, rounds)
+  VALUES ($1, $2, $3, $4)
+  ON CONFLICT (workout_id, label) DO UPDATE
+  SET group_type = EXCLUDED.group_type, rounds = EXCLUDED.rounds, updated_at = NOW()
+  RETURNING id
+  `
+	for i := range groups {
+		group := &groups[i]
+		err = tx.QueryRow(query, workout.ID, group.Label, group.Type, group.Rounds).Scan(&group.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	workout.Groups = groups
+	return nil
+}
+
+// groupID returns the ID of the group entry belongs to, if any.
+func groupID(workout *Workout, entry *WorkoutEntry) *int {
+	if entry.Group == nil {
+		return nil
+	}
+	for _, group := range workout.Groups {
+		if group.Label == *entry.Group {
+			return &group.ID
+		}
+	}
+	return nil
+}
+
+// loadGroups fills in the groups of workouts, ordered by where their first
+// entry is.
+func loadGroups(q queryer, workouts []*Workout) error {
+	if len(workouts) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(workouts))
+	byID := make(map[int]*Workout, len(workouts))
+	for i, workout := range workouts {
+		ids[i] = int64(workout.ID)
+		byID[workout.ID] = workout
+		workout.Groups = []WorkoutEntryGroup{}
+	}
+
+	query := `
+  SELECT workout_id, id, label, group_type, rounds
+  FROM workout_entry_groups
+  WHERE workout_id = ANY($1)
+  `
+
+	rows, err := q.Query(query, ids)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var workoutID int
+		var group WorkoutEntryGroup
+		err = rows.Scan(&workoutID, &group.ID, &group.Label, &group.Type, &group.Rounds)
+		if err != nil {
+			return err
+		}
+
+		workout := byID[workoutID]
+		workout.Groups = append(workout.Groups, group)
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, workout := range workouts {
+		sortGroups(workout)
+	}
+
+	return nil
+}
+
+func sortGroups(workout *Workout) {
+	first := make(map[string]int, len(workout.Groups))
+	for _, entry := range workout.Entries {
+		if entry.Group == nil {
+			continue
+		}
+		if _, ok := first[*entry.Group]; !ok {
+			first[*entry.Group] = entry.OrderIndex
+		}
+	}
+
+	sort.SliceStable(workout.Groups, func(i, j int) bool {
+		return first[workout.Groups[i].Label] < first[workout.Groups[j].Label]
+	})
+}
@@ -0,0 +1,35 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSortGroups(t *testing.T) {
+	a, b := "A", "B"
+	workout := &Workout{
+		Groups: []WorkoutEntryGroup{
+			{ID: 2, Label: b, Type: GroupTypeCircuit, Rounds: 3},
+			{ID: 1, Label: a, Type: GroupTypeSuperset, Rounds: 1},
+		},
+		Entries: []WorkoutEntry{
+			{ExerciseName: "Squat", OrderIndex: 1},
+			{ExerciseName: "Bench Press", OrderIndex: 2, Group: &a},
+			{ExerciseName: "Row", OrderIndex: 3, Group: &a},
+			{ExerciseName: "Burpees", OrderIndex: 4, Group: &b},
+		},
+	}
+
+	sortGroups(workout)
+
+	require.Len(t, workout.Groups, 2)
+	assert.Equal(t, "A", workout.Groups[0].Label)
+	assert.Equal(t, "B", workout.Groups[1].Label)
+
+	id := groupID(workout, &workout.Entries[3])
+	require.NotNil(t, id)
+	assert.Equal(t, 2, *id)
+	assert.Nil(t, groupID(workout, &workout.Entries[0]))
+}
@@ -0,0 +1,282 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// WorkoutRevision is the state of a workout right before one of its updates.
+type WorkoutRevision struct {
+	ID        int       `json:"id"`
+	WorkoutID int       `json:"workout_id"`
+	Revision  int       `json:"revision"`
+	Snapshot  *Workout  `json:"snapshot"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func insertRevision(tx *sql.Tx, workout *Workout) error {
+	snapshot, err := json.Marshal(workout)
+	if err != nil {
+		return err
+	}
+
+	query := `
+  INSERT INTO workout_revisions (workout_id, revision, snapshot)
+  SELECT $1, COALESCE(MAX(revision), 0) + 1, $2
+  FROM workout_revisions
+  WHERE workout_id = $1
+  `
+
+	_, err = tx.Exec(query, workout.ID, snapshot)
+	return err
+}
+
+func (pg *PostgresWorkoutStore) ListRevisions(workoutID int64) ([]*WorkoutRevision, error) {
+	query := `
+  SELECT id, workout_id, revision, snapshot, created_at
+  FROM workout_revisions
+  WHERE workout_id = $1
+  ORDER BY revision
+  `
+
+	rows, err := pg.db.Query(query, workoutID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	revisions := []*WorkoutRevision{}
+	for rows.Next() {
+		revision, err := scanRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, rows.Err()
+}
+
+func (pg *PostgresWorkoutStore) GetRevision(workoutID int64, revision int) (*WorkoutRevision, error) {
+	query := `
+  SELECT id, workout_id, revision, snapshot, created_at
+  FROM workout_revisions
+  WHERE workout_id = $1 AND revision = $2
+  `
+
+	found, err := scanRevision(pg.db.QueryRow(query, workoutID, revision))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = dropMissingExercises(pg.db, found.Snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	return found, nil
+}
+
+// dropMissingExercises unlinks the entries of a snapshot from exercises that
+// were deleted since it was taken, so that restoring it doesn't fail
+// checkExercises. The entries keep their name and are matched again by it.
+func dropMissingExercises(q queryer, snapshot *Workout) error {
+	var referenced []int64
+	for _, entry := range snapshot.Entries {
+		if entry.ExerciseID != nil {
+			referenced = append(referenced, int64(*entry.ExerciseID))
+		}
+	}
+
+	if len(referenced) == 0 {
+		return nil
+	}
+
+	query := `
+  SELECT id
+  FROM exercises
+  WHERE id = ANY($1) AND (owner_id IS NULL OR owner_id = $2)
+  `
+
+	rows, err := q.Query(query, referenced, snapshot.UserID)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	usable := map[int]bool{}
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			return err
+		}
+		usable[id] = true
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range snapshot.Entries {
+		entry := &snapshot.Entries[i]
+		if entry.ExerciseID != nil && !usable[*entry.ExerciseID] {
+			entry.ExerciseID = nil
+		}
+	}
+
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanRevision(row scanner) (*WorkoutRevision, error) {
+	var revision WorkoutRevision
+	var snapshot []byte
+	err := row.Scan(&revision.ID, &revision.WorkoutID, &revision.Revision, &snapshot, &revision.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	revision.Snapshot = &Workout{}
+	if err = json.Unmarshal(snapshot, revision.Snapshot); err != nil {
+		return nil, err
+	}
+
+	return &revision, nil
+}
+
+type FieldChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+const (
+	EntryAdded    = "added"
+	EntryRemoved  = "removed"
+	EntryModified = "modified"
+)
+
+type EntryChange struct {
+	Change  string        `json:"change"`
+	EntryID int           `json:"entry_id,omitempty"`
+	Entry   *WorkoutEntry `json:"entry,omitempty"`
+	Fields  []FieldChange `json:"fields,omitempty"`
+}
+
+type WorkoutDiff struct {
+	Fields  []FieldChange `json:"fields"`
+	Entries []EntryChange `json:"entries"`
+}
+
+// workoutDiffIgnored lists fields that are bookkeeping rather than content.
+var workoutDiffIgnored = map[string]bool{
+	"id":         true,
+	"user_id":    true,
+	"version":    true,
+	"created_at": true,
+	"deleted_at": true,
+	"entries":    true,
+}
+
+// DiffWorkouts describes how to go from one version of a workout to another.
+// Entries are paired by ID and, when IDs don't match, by position.
+func DiffWorkouts(from, to *Workout) WorkoutDiff {
+	diff := WorkoutDiff{
+		Fields:  diffFields(toJSONMap(from), toJSONMap(to), workoutDiffIgnored),
+		Entries: []EntryChange{},
+	}
+
+	toByID := make(map[int]int, len(to.Entries))
+	for i, entry := range to.Entries {
+		if entry.ID != 0 {
+			toByID[entry.ID] = i
+		}
+	}
+
+	pairedTo := make(map[int]bool, len(to.Entries))
+	pairs := make(map[int]int, len(from.Entries))
+	for i, entry := range from.Entries {
+		if j, ok := toByID[entry.ID]; ok && entry.ID != 0 {
+			pairs[i] = j
+			pairedTo[j] = true
+		}
+	}
+
+	var unpairedTo []int
+	for j := range to.Entries {
+		if !pairedTo[j] {
+			unpairedTo = append(unpairedTo, j)
+		}
+	}
+	for i := range from.Entries {
+		if _, ok := pairs[i]; ok || len(unpairedTo) == 0 {
+			continue
+		}
+		pairs[i] = unpairedTo[0]
+		pairedTo[unpairedTo[0]] = true
+		unpairedTo = unpairedTo[1:]
+	}
+
+	for i := range from.Entries {
+		old := from.Entries[i]
+		j, ok := pairs[i]
+		if !ok {
+			diff.Entries = append(diff.Entries, EntryChange{Change: EntryRemoved, EntryID: old.ID, Entry: &old})
+			continue
+		}
+
+		fields := diffFields(toJSONMap(old), toJSONMap(to.Entries[j]), map[string]bool{"id": true})
+		if len(fields) > 0 {
+			diff.Entries = append(diff.Entries, EntryChange{Change: EntryModified, EntryID: old.ID, Fields: fields})
+		}
+	}
+
+	for j := range to.Entries {
+		if !pairedTo[j] {
+			added := to.Entries[j]
+			diff.Entries = append(diff.Entries, EntryChange{Change: EntryAdded, EntryID: added.ID, Entry: &added})
+		}
+	}
+
+	return diff
+}
+
+func toJSONMap(value any) map[string]any {
+	data, _ := json.Marshal(value)
+	fields := map[string]any{}
+	_ = json.Unmarshal(data, &fields)
+	return fields
+}
+
+func diffFields(from, to map[string]any, ignored map[string]bool) []FieldChange {
+	keys := make(map[string]bool, len(from)+len(to))
+	for key := range from {
+		keys[key] = true
+	}
+	for key := range to {
+		keys[key] = true
+	}
+
+	changes := []FieldChange{}
+	for key := range keys {
+		if ignored[key] || reflect.DeepEqual(from[key], to[key]) {
+			continue
+		}
+		changes = append(changes, FieldChange{Field: key, From: from[key], To: to[key]})
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
@@ -0,0 +1,53 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffWorkouts(t *testing.T) {
+	from := &Workout{
+		ID:              1,
+		Title:           "push day",
+		DurationMinutes: 60,
+		Visibility:      VisibilityPrivate,
+		Entries: []WorkoutEntry{
+			{ID: 10, ExerciseName: "Bench Press", Sets: 3, Reps: IntPtr(10), OrderIndex: 1},
+			{ID: 11, ExerciseName: "Dips", Sets: 3, Reps: IntPtr(12), OrderIndex: 2},
+		},
+	}
+	to := &Workout{
+		ID:              1,
+		Title:           "push day",
+		DurationMinutes: 75,
+		Visibility:      VisibilityPublic,
+		Entries: []WorkoutEntry{
+			{ID: 10, ExerciseName: "Bench Press", Sets: 4, Reps: IntPtr(10), OrderIndex: 1},
+			{ExerciseName: "Push Ups", Sets: 2, Reps: IntPtr(20), OrderIndex: 2},
+			{ExerciseName: "Plank", Sets: 1, DurationSeconds: IntPtr(60), OrderIndex: 3},
+		},
+	}
+
+	diff := DiffWorkouts(from, to)
+
+	assert.Equal(t, []FieldChange{
+		{Field: "duration_minutes", From: float64(60), To: float64(75)},
+		{Field: "visibility", From: VisibilityPrivate, To: VisibilityPublic},
+	}, diff.Fields)
+
+	if assert.Len(t, diff.Entries, 3) {
+		assert.Equal(t, EntryModified, diff.Entries[0].Change)
+		assert.Equal(t, 10, diff.Entries[0].EntryID)
+		assert.Equal(t, []FieldChange{{Field: "sets", From: float64(3), To: float64(4)}}, diff.Entries[0].Fields)
+
+		assert.Equal(t, EntryModified, diff.Entries[1].Change)
+		assert.Equal(t, 11, diff.Entries[1].EntryID)
+
+		assert.Equal(t, EntryAdded, diff.Entries[2].Change)
+		assert.Equal(t, "Plank", diff.Entries[2].Entry.ExerciseName)
+	}
+
+	assert.Empty(t, DiffWorkouts(to, to).Fields)
+	assert.Empty(t, DiffWorkouts(to, to).Entries)
+}
@@ -0,0 +1,200 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+const (
+	SetTypeWarmUp  = "warmup"
+	SetTypeWorking = "working"
+	SetTypeDrop    = "drop"
+	SetTypeFailure = "failure"
+)
+
+func IsValidSetType(setType string) bool {
+	switch setType {
+	case SetTypeWarmUp, SetTypeWorking, SetTypeDrop, SetTypeFailure:
+		return true
+	}
+	return false
+}
+
+// WorkoutSet is one set of an entry. Type defaults to working and Completed
+// to true when they are left out. Like entries, sets keep Weight in kilograms
+// and Distance in meters.
+type WorkoutSet struct {
+	SetNumber       int      `json:"set_number"`
+	Type            string   `json:"type"`
+	Reps            *int     `json:"reps"`
+	DurationSeconds *int     `json:"duration_seconds"`
+	Weight          *float64 `json:"weight"`
+	Distance        *float64 `json:"distance"`
+	RPE             *float64 `json:"rpe"`
+	RIR             *int     `json:"rir"`
+	Completed       *bool    `json:"completed"`
+}
+
+// normalizeSets numbers the sets of entry from 1 in the given order and fills
+// in defaults.
+func normalizeSets(entry *WorkoutEntry) {
+	for i := range entry.SetDetails {
+		set := &entry.SetDetails[i]
+		set.SetNumber = i + 1
+		if set.Type == "" {
+			set.Type = SetTypeWorking
+		}
+		if set.Completed == nil {
+			completed := true
+			set.Completed = &completed
+		}
+	}
+}
+
+// summarizeSets keeps the aggregate fields of an entry logged per set in line
+// with its sets: sets is their count and reps, duration_seconds, weight and
+// distance come from the first working set, or the first set if there is none.
+func summarizeSets(entry *WorkoutEntry) {
+	if len(entry.SetDetails) == 0 {
+		return
+	}
+
+	top := entry.SetDetails[0]
+	for _, set := range entry.SetDetails {
+		if set.Type == SetTypeWorking {
+			top = set
+			break
+		}
+	}
+
+	entry.Sets = len(entry.SetDetails)
+	entry.Reps = top.Reps
+	entry.DurationSeconds = top.DurationSeconds
+	entry.Weight = top.Weight
+	entry.Distance = top.Distance
+}
+
+// legacySets describes an entry that was only logged in aggregate as that many
+// identical completed working sets.
+func legacySets(entry WorkoutEntry) []WorkoutSet {
+	sets := make([]WorkoutSet, entry.Sets)
+	for i := range sets {
+		completed := true
+		sets[i] = WorkoutSet{
+			SetNumber:       i + 1,
+			Type:            SetTypeWorking,
+			Reps:            entry.Reps,
+			DurationSeconds: entry.DurationSeconds,
+			Weight:          entry.Weight,
+			Distance:        entry.Distance,
+			Completed:       &completed,
+		}
+	}
+	return sets
+}
+
+// ErrEntryLoggedPerSet means an update changed the aggregate fields of an
+// entry whose sets can't be derived from them.
+var ErrEntryLoggedPerSet = errors.New("entry is logged per set, change its set_details instead of its aggregate fields")
+
+// resolveEntryShape decides which shape of an updated entry wins. Entries are
+// always read with their sets, so a client that only edits the aggregate
+// fields sends the old sets back along with them. The sets are dropped and
+// the entry is stored in aggregate only when they said nothing more than the
+// aggregate did; sets logged one by one are never discarded that way.
+func resolveEntryShape(entry *WorkoutEntry, previous WorkoutEntry) error {
+	if len(entry.SetDetails) == 0 || !reflect.DeepEqual(entry.SetDetails, previous.SetDetails) {
+		return nil
+	}
+
+	if entry.Sets == previous.Sets &&
+		reflect.DeepEqual(entry.Reps, previous.Reps) &&
+		reflect.DeepEqual(entry.DurationSeconds, previous.DurationSeconds) &&
+		reflect.DeepEqual(entry.Weight, previous.Weight) &&
+		reflect.DeepEqual(entry.Distance, previous.Distance) {
+		return nil
+	}
+
+	if !reflect.DeepEqual(previous.SetDetails, legacySets(previous)) {
+		return fmt.Errorf("entry %d: %w", entry.ID, ErrEntryLoggedPerSet)
+	}
+
+	entry.SetDetails = nil
+	return nil
+}
+
+// saveSets replaces the stored sets of an entry.
+func saveSets(tx *sql.Tx, entry *WorkoutEntry) error {
+	_, err := tx.Exec("DELETE FROM workout_sets WHERE entry_id = $1", entry.ID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+  INSERT INTO workout_sets (entry_id, set_number, set_type, reps, duration_seconds, weight, distance_meters, rpe, rir, completed)
+  VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+  `
+	for _, set := range entry.SetDetails {
+		_, err = tx.Exec(query, entry.ID, set.SetNumber, set.Type, set.Reps, set.DurationSeconds, set.Weight, set.Distance, set.RPE, set.RIR, set.Completed)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadSets fills in the sets of entries. Entries without stored sets were
+// logged in aggregate and get them from legacySets.
+func loadSets(q queryer, entries []*WorkoutEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(entries))
+	byID := make(map[int]*WorkoutEntry, len(entries))
+	for i, entry := range entries {
+		ids[i] = int64(entry.ID)
+		byID[entry.ID] = entry
+	}
+
+	query := `
+  SELECT entry_id, set_number, set_type, reps, duration_seconds, weight, distance_meters, rpe, rir, completed
+  FROM workout_sets
+  WHERE entry_id = ANY($1)
+  ORDER BY entry_id, set_number
+  `
+
+	rows, err := q.Query(query, ids)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var entryID int
+		var set WorkoutSet
+		err = rows.Scan(&entryID, &set.SetNumber, &set.Type, &set.Reps, &set.DurationSeconds, &set.Weight, &set.Distance, &set.RPE, &set.RIR, &set.Completed)
+		if err != nil {
+			return err
+		}
+
+		entry := byID[entryID]
+		entry.SetDetails = append(entry.SetDetails, set)
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if len(entry.SetDetails) == 0 {
+			entry.SetDetails = legacySets(*entry)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummarizeSets(t *testing.T) {
+	entry := WorkoutEntry{
+		ExerciseName: "Bench Press",
+		SetDetails: []WorkoutSet{
+			{Type: SetTypeWarmUp, Reps: IntPtr(12), Weight: FloatPtr(40)},
+			{Reps: IntPtr(8), Weight: FloatPtr(80)},
+			{Type: SetTypeDrop, Reps: IntPtr(10), Weight: FloatPtr(60)},
+			{Type: SetTypeFailure, Reps: IntPtr(0), Weight: FloatPtr(80)},
+		},
+	}
+
+	normalizeSets(&entry)
+	summarizeSets(&entry)
+
+	for i, set := range entry.SetDetails {
+		assert.Equal(t, i+1, set.SetNumber)
+		require.NotNil(t, set.Completed)
+		assert.True(t, *set.Completed)
+	}
+	assert.Equal(t, SetTypeWorking, entry.SetDetails[1].Type)
+	assert.Equal(t, 4, entry.Sets)
+	assert.Equal(t, 8, *entry.Reps)
+	assert.Equal(t, 80.0, *entry.Weight)
+	assert.Nil(t, entry.DurationSeconds)
+}
+
+func TestLegacySets(t *testing.T) {
+	entry := WorkoutEntry{ExerciseName: "Plank", Sets: 3, DurationSeconds: IntPtr(60)}
+
+	sets := legacySets(entry)
+
+	require.Len(t, sets, 3)
+	for i, set := range sets {
+		assert.Equal(t, i+1, set.SetNumber)
+		assert.Equal(t, SetTypeWorking, set.Type)
+		assert.Equal(t, 60, *set.DurationSeconds)
+		assert.Nil(t, set.Reps)
+		assert.True(t, *set.Completed)
+	}
+}
+
+func TestResolveEntryShape(t *testing.T) {
+	previous := WorkoutEntry{ID: 1, ExerciseName: "Squat", Sets: 3, Reps: IntPtr(5), Weight: FloatPtr(100)}
+	previous.SetDetails = legacySets(previous)
+
+	t.Run("edited aggregate replaces the sets", func(t *testing.T) {
+		entry := previous
+		entry.Reps = IntPtr(6)
+
+		normalizeSets(&entry)
+		require.NoError(t, resolveEntryShape(&entry, previous))
+
+		assert.Nil(t, entry.SetDetails)
+	})
+
+	t.Run("edited aggregate of sets logged one by one is rejected", func(t *testing.T) {
+		logged := previous
+		logged.SetDetails = append(legacySets(previous), WorkoutSet{Type: SetTypeDrop, Reps: IntPtr(8), Weight: FloatPtr(80)})
+		normalizeSets(&logged)
+		summarizeSets(&logged)
+
+		entry := logged
+		entry.Weight = FloatPtr(82.5)
+
+		err := resolveEntryShape(&entry, logged)
+
+		assert.ErrorIs(t, err, ErrEntryLoggedPerSet)
+		assert.Len(t, entry.SetDetails, 4)
+	})
+
+	t.Run("edited sets win", func(t *testing.T) {
+		entry := previous
+		entry.SetDetails = append(legacySets(previous), WorkoutSet{Type: SetTypeDrop, Reps: IntPtr(8), Weight: FloatPtr(80)})
+
+		normalizeSets(&entry)
+		require.NoError(t, resolveEntryShape(&entry, previous))
+		summarizeSets(&entry)
+
+		assert.Len(t, entry.SetDetails, 4)
+		assert.Equal(t, 4, entry.Sets)
+	})
+
+	t.Run("unchanged entry keeps its sets", func(t *testing.T) {
+		entry := previous
+
+		normalizeSets(&entry)
+		require.NoError(t, resolveEntryShape(&entry, previous))
+
+		assert.Len(t, entry.SetDetails, 3)
+	})
+}
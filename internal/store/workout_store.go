@@ -1,26 +1,84 @@
 package store
 
-import "database/sql"
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrVersionConflict means the workout changed since the caller last read it.
+var ErrVersionConflict = errors.New("workout was modified concurrently")
+
+const (
+	VisibilityPrivate   = "private"
+	VisibilityFollowers = "followers"
+	VisibilityPublic    = "public"
+)
+
+func IsValidVisibility(visibility string) bool {
+	switch visibility {
+	case VisibilityPrivate, VisibilityFollowers, VisibilityPublic:
+		return true
+	}
+	return false
+}
 
 type Workout struct {
-	ID              int            `json:"id"`
-	Title           string         `json:"title"`
-	UserID          int            `json:"user_id"`
-	Description     string         `json:"description"`
-	DurationMinutes int            `json:"duration_minutes"`
-	CaloriesBurned  int            `json:"calories_burned"`
-	Entries         []WorkoutEntry `json:"entries"`
+	ID              int                 `json:"id"`
+	Title           string              `json:"title"`
+	UserID          int                 `json:"user_id"`
+	Description     string              `json:"description"`
+	DurationMinutes int                 `json:"duration_minutes"`
+	CaloriesBurned  int                 `json:"calories_burned"`
+	Visibility      string              `json:"visibility"`
+	Version         int                 `json:"version"`
+	CreatedAt       time.Time           `json:"created_at"`
+	DeletedAt       *time.Time          `json:"deleted_at,omitempty"`
+	Groups          []WorkoutEntryGroup `json:"groups"`
+	Entries         []WorkoutEntry      `json:"entries"`
 }
 
+// WorkoutEntry keeps Weight in kilograms and Distance in meters. The API
+// converts them to the units of the user it answers.
 type WorkoutEntry struct {
 	ID              int      `json:"id"`
+	ExerciseID      *int     `json:"exercise_id"`
 	ExerciseName    string   `json:"exercise_name"`
 	Sets            int      `json:"sets"`
 	Reps            *int     `json:"reps"`
 	DurationSeconds *int     `json:"duration_seconds"`
 	Weight          *float64 `json:"weight"`
+	Distance        *float64 `json:"distance"`
 	Notes           string   `json:"notes"`
 	OrderIndex      int      `json:"order_index"`
+	// Group is the label of the group the entry belongs to, if any.
+	Group *string `json:"group"`
+	// SetDetails logs the entry set by set. When it is given, the aggregate
+	// fields above are derived from it.
+	SetDetails []WorkoutSet `json:"set_details"`
+}
+
+type WorkoutCursor struct {
+	CreatedAt time.Time
+	ID        int
+}
+
+type WorkoutFilter struct {
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	Title       string
+	MinDuration *int
+	MinCalories *int
+	MaxCalories *int
+	Cursor      *WorkoutCursor
+	Limit       int
+	// Trashed lists soft deleted workouts instead of live ones.
+	Trashed bool
 }
 
 type PostgresWorkoutStore struct {
@@ -35,9 +93,15 @@ func NewPostgresWorkoutStore(db *sql.DB) *PostgresWorkoutStore {
 type WorkoutStore interface {
 	Create(workout *Workout) (*Workout, error)
 	GetByID(id int64) (*Workout, error)
+	ListByUser(userID int, filter WorkoutFilter) ([]*Workout, *WorkoutCursor, error)
 	Update(*Workout) error
-	Delete(id int64) error
+	Delete(id int64, version int) error
+	Restore(id int64) error
+	DeletePermanently(id int64) error
+	PurgeDeleted(before time.Time) (int64, error)
 	GetWorkoutOwner(id int64) (int, error)
+	ListRevisions(workoutID int64) ([]*WorkoutRevision, error)
+	GetRevision(workoutID int64, revision int) (*WorkoutRevision, error)
 }
 
 func (pg *PostgresWorkoutStore) Create(workout *Workout) (*Workout, error) {
@@ -48,28 +112,36 @@ func (pg *PostgresWorkoutStore) Create(workout *Workout) (*Workout, error) {
 
 	defer tx.Rollback()
 
+	normalizeEntryOrder(workout.Entries)
+
 	query := `
-  INSERT INTO workouts (user_id, title, description, duration_minutes, calories_burned)
-  VALUES ($1, $2, $3, $4, $5)
-  RETURNING id
+  INSERT INTO workouts (user_id, title, description, duration_minutes, calories_burned, visibility)
+  VALUES ($1, $2, $3, $4, $5, COALESCE(NULLIF($6, ''), 'private'))
+  RETURNING id, visibility, version, created_at
   `
 
-	err = tx.QueryRow(query, workout.UserID, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned).Scan(&workout.ID)
+	err = tx.QueryRow(query, workout.UserID, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.Visibility).Scan(&workout.ID, &workout.Visibility, &workout.Version, &workout.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
 
-	for _, entry := range workout.Entries {
-		query := `
-      INSERT INTO workout_entries (workout_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index)
-      VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-      RETURNING id
-      `
-		err := tx.QueryRow(query, workout.ID, entry.ExerciseName, entry.Sets, entry.Reps, entry.DurationSeconds, entry.Weight, entry.Notes, entry.OrderIndex).Scan(&entry.ID)
+	err = checkExercises(tx, workout)
+	if err != nil {
+		return nil, err
+	}
+
+	err = saveGroups(tx, workout)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range workout.Entries {
+		err = insertEntry(tx, workout, &workout.Entries[i])
 		if err != nil {
 			return nil, err
 		}
 	}
+	sortGroups(workout)
 
 	err = tx.Commit()
 	if err != nil {
@@ -79,16 +151,30 @@ func (pg *PostgresWorkoutStore) Create(workout *Workout) (*Workout, error) {
 	return workout, nil
 }
 
+type queryer interface {
+	QueryRow(query string, args ...any) *sql.Row
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
 func (pg *PostgresWorkoutStore) GetByID(id int64) (*Workout, error) {
+	return getWorkout(pg.db, id, false)
+}
+
+// getWorkout loads a live workout with its entries. With forUpdate the
+// workout row stays locked until the surrounding transaction ends.
+func getWorkout(q queryer, id int64, forUpdate bool) (*Workout, error) {
 	var workout Workout
 
 	query := `
-  SELECT id, title, description, duration_minutes, calories_burned
+  SELECT id, user_id, title, description, duration_minutes, calories_burned, visibility, version, created_at
   FROM workouts
-  WHERE id = $1
+  WHERE id = $1 AND deleted_at IS NULL
   `
+	if forUpdate {
+		query += "FOR UPDATE"
+	}
 
-	err := pg.db.QueryRow(query, id).Scan(&workout.ID, &workout.Title, &workout.Description, &workout.DurationMinutes, &workout.CaloriesBurned)
+	err := q.QueryRow(query, id).Scan(&workout.ID, &workout.UserID, &workout.Title, &workout.Description, &workout.DurationMinutes, &workout.CaloriesBurned, &workout.Visibility, &workout.Version, &workout.CreatedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -98,13 +184,14 @@ func (pg *PostgresWorkoutStore) GetByID(id int64) (*Workout, error) {
 	}
 
 	entryQuery := `
-  SELECT id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index
-  FROM workout_entries
-  WHERE workout_id = $1
-  ORDER BY order_index
+  SELECT e.id, e.exercise_id, e.exercise_name, e.sets, e.reps, e.duration_seconds, e.weight, e.distance_meters, e.notes, e.order_index, g.label
+  FROM workout_entries e
+  LEFT JOIN workout_entry_groups g ON g.id = e.group_id
+  WHERE e.workout_id = $1
+  ORDER BY e.order_index
   `
 
-	rows, err := pg.db.Query(entryQuery, workout.ID)
+	rows, err := q.Query(entryQuery, workout.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -113,7 +200,7 @@ func (pg *PostgresWorkoutStore) GetByID(id int64) (*Workout, error) {
 
 	for rows.Next() {
 		var entry WorkoutEntry
-		err = rows.Scan(&entry.ID, &entry.ExerciseName, &entry.Sets, &entry.Reps, &entry.DurationSeconds, &entry.Weight, &entry.Notes, &entry.OrderIndex)
+		err = rows.Scan(&entry.ID, &entry.ExerciseID, &entry.ExerciseName, &entry.Sets, &entry.Reps, &entry.DurationSeconds, &entry.Weight, &entry.Distance, &entry.Notes, &entry.OrderIndex, &entry.Group)
 
 		if err != nil {
 			return nil, err
@@ -122,9 +209,177 @@ func (pg *PostgresWorkoutStore) GetByID(id int64) (*Workout, error) {
 		workout.Entries = append(workout.Entries, entry)
 	}
 
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	entries := make([]*WorkoutEntry, len(workout.Entries))
+	for i := range workout.Entries {
+		entries[i] = &workout.Entries[i]
+	}
+
+	err = loadSets(q, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	err = loadGroups(q, []*Workout{&workout})
+	if err != nil {
+		return nil, err
+	}
+
 	return &workout, nil
 }
 
+func (pg *PostgresWorkoutStore) ListByUser(userID int, filter WorkoutFilter) ([]*Workout, *WorkoutCursor, error) {
+	conditions := []string{"user_id = $1"}
+	args := []any{userID}
+	addCondition := func(condition string, values ...any) {
+		placeholders := make([]any, len(values))
+		for i, value := range values {
+			args = append(args, value)
+			placeholders[i] = len(args)
+		}
+		conditions = append(conditions, fmt.Sprintf(condition, placeholders...))
+	}
+
+	if filter.Trashed {
+		conditions = append(conditions, "deleted_at IS NOT NULL")
+	} else {
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+	if filter.CreatedFrom != nil {
+		addCondition("created_at >= $%d", *filter.CreatedFrom)
+	}
+	if filter.CreatedTo != nil {
+		addCondition("created_at < $%d", *filter.CreatedTo)
+	}
+	if filter.Title != "" {
+		addCondition("title ILIKE $%d", "%"+escapeLike(filter.Title)+"%")
+	}
+	if filter.MinDuration != nil {
+		addCondition("duration_minutes >= $%d", *filter.MinDuration)
+	}
+	if filter.MinCalories != nil {
+		addCondition("calories_burned >= $%d", *filter.MinCalories)
+	}
+	if filter.MaxCalories != nil {
+		addCondition("calories_burned <= $%d", *filter.MaxCalories)
+	}
+	if filter.Cursor != nil {
+		addCondition("(created_at, id) < ($%d, $%d)", filter.Cursor.CreatedAt, filter.Cursor.ID)
+	}
+
+	// fetch one extra row to know whether there is a next page
+	args = append(args, filter.Limit+1)
+	query := fmt.Sprintf(`
+  SELECT id, user_id, title, description, duration_minutes, calories_burned, visibility, version, created_at, deleted_at
+  FROM workouts
+  WHERE %s
+  ORDER BY created_at DESC, id DESC
+  LIMIT $%d
+  `, strings.Join(conditions, " AND "), len(args))
+
+	rows, err := pg.db.Query(query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer rows.Close()
+
+	workouts := []*Workout{}
+	for rows.Next() {
+		var workout Workout
+		err = rows.Scan(&workout.ID, &workout.UserID, &workout.Title, &workout.Description, &workout.DurationMinutes, &workout.CaloriesBurned, &workout.Visibility, &workout.Version, &workout.CreatedAt, &workout.DeletedAt)
+		if err != nil {
+			return nil, nil, err
+		}
+		workouts = append(workouts, &workout)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	var next *WorkoutCursor
+	if len(workouts) > filter.Limit {
+		workouts = workouts[:filter.Limit]
+		last := workouts[len(workouts)-1]
+		next = &WorkoutCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+
+	err = pg.loadEntries(workouts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return workouts, next, nil
+}
+
+func (pg *PostgresWorkoutStore) loadEntries(workouts []*Workout) error {
+	if len(workouts) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(workouts))
+	byID := make(map[int]*Workout, len(workouts))
+	for i, workout := range workouts {
+		ids[i] = int64(workout.ID)
+		byID[workout.ID] = workout
+	}
+
+	query := `
+  SELECT e.workout_id, e.id, e.exercise_id, e.exercise_name, e.sets, e.reps, e.duration_seconds, e.weight, e.distance_meters, e.notes, e.order_index, g.label
+  FROM workout_entries e
+  LEFT JOIN workout_entry_groups g ON g.id = e.group_id
+  WHERE e.workout_id = ANY($1)
+  ORDER BY e.workout_id, e.order_index
+  `
+
+	rows, err := pg.db.Query(query, ids)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var workoutID int
+		var entry WorkoutEntry
+		err = rows.Scan(&workoutID, &entry.ID, &entry.ExerciseID, &entry.ExerciseName, &entry.Sets, &entry.Reps, &entry.DurationSeconds, &entry.Weight, &entry.Distance, &entry.Notes, &entry.OrderIndex, &entry.Group)
+		if err != nil {
+			return err
+		}
+
+		workout := byID[workoutID]
+		workout.Entries = append(workout.Entries, entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	var entries []*WorkoutEntry
+	for _, workout := range workouts {
+		for i := range workout.Entries {
+			entries = append(entries, &workout.Entries[i])
+		}
+	}
+
+	err = loadSets(pg.db, entries)
+	if err != nil {
+		return err
+	}
+
+	return loadGroups(pg.db, workouts)
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
 func (pg *PostgresWorkoutStore) Update(workout *Workout) error {
 	tx, err := pg.db.Begin()
 	if err != nil {
@@ -133,53 +388,281 @@ func (pg *PostgresWorkoutStore) Update(workout *Workout) error {
 
 	defer tx.Rollback()
 
+	previous, err := getWorkout(tx, int64(workout.ID), true)
+	if err != nil {
+		return err
+	}
+
+	if previous == nil {
+		return sql.ErrNoRows
+	}
+
+	if previous.Version != workout.Version {
+		return ErrVersionConflict
+	}
+
+	err = insertRevision(tx, previous)
+	if err != nil {
+		return err
+	}
+
 	query := `
   UPDATE workouts
-  SET title = $1, description = $2, duration_minutes = $3, calories_burned = $4
-  WHERE id = $5
+  SET title = $1, description = $2, duration_minutes = $3, calories_burned = $4, visibility = $5, version = version + 1, updated_at = NOW()
+  WHERE id = $6 AND version = $7 AND deleted_at IS NULL
+  RETURNING version
   `
-	result, err := tx.Exec(query, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.ID)
+	err = tx.QueryRow(query, workout.Title, workout.Description, workout.DurationMinutes, workout.CaloriesBurned, workout.Visibility, workout.ID, workout.Version).Scan(&workout.Version)
+	if err == sql.ErrNoRows {
+		return ErrVersionConflict
+	}
+
 	if err != nil {
 		return err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	err = checkExercises(tx, workout)
 	if err != nil {
 		return err
 	}
 
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
+	normalizeEntryOrder(workout.Entries)
+	err = saveGroups(tx, workout)
+	if err != nil {
+		return err
 	}
 
-	_, err = tx.Exec("DELETE FROM workout_entries WHERE workout_id = $1", workout.ID)
-
+	err = saveEntries(tx, workout, previous.Entries)
 	if err != nil {
 		return err
 	}
+	sortGroups(workout)
+
+	return tx.Commit()
+}
+
+// normalizeEntryOrder sorts entries by order_index, keeping the given order
+// for ties, and renumbers them from 1 so that order_index has no gaps.
+func normalizeEntryOrder(entries []WorkoutEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].OrderIndex < entries[j].OrderIndex
+	})
+	for i := range entries {
+		entries[i].OrderIndex = i + 1
+	}
+}
+
+// saveEntries makes the stored entries match workout.Entries. Entries whose ID
+// belongs to the workout are updated in place so their IDs stay stable, the
+// rest are inserted and missing ones are deleted.
+func saveEntries(tx *sql.Tx, workout *Workout, previous []WorkoutEntry) error {
+	existing := make(map[int]bool, len(previous))
+	previousByID := make(map[int]WorkoutEntry, len(previous))
+	for _, entry := range previous {
+		existing[entry.ID] = true
+		previousByID[entry.ID] = entry
+	}
 
+	kept := make(map[int]bool, len(workout.Entries))
 	for _, entry := range workout.Entries {
+		if existing[entry.ID] {
+			kept[entry.ID] = true
+		}
+	}
+
+	var removed []int64
+	for id := range existing {
+		if !kept[id] {
+			removed = append(removed, int64(id))
+		}
+	}
+
+	if len(removed) > 0 {
+		_, err := tx.Exec("DELETE FROM workout_entries WHERE workout_id = $1 AND id = ANY($2)", workout.ID, removed)
+		if err != nil {
+			return err
+		}
+	}
+
+	updated := make(map[int]bool, len(kept))
+	for i := range workout.Entries {
+		entry := &workout.Entries[i]
+		if !kept[entry.ID] || updated[entry.ID] {
+			err := insertEntry(tx, workout, entry)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		updated[entry.ID] = true
+		normalizeSets(entry)
+		err := resolveEntryShape(entry, previousByID[entry.ID])
+		if err != nil {
+			return err
+		}
+		summarizeSets(entry)
+
 		query := `
-      INSERT INTO workout_entries (workout_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index)
-      VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+      UPDATE workout_entries
+      SET exercise_name = COALESCE(NULLIF($1, ''), (SELECT name FROM exercises WHERE id = $8), ''),
+        sets = $2, reps = $3, duration_seconds = $4, weight = $5, notes = $6, order_index = $7,
+        exercise_id = COALESCE($8, match_exercise_exactly($1, $11)), group_id = $12, distance_meters = $13, updated_at = NOW()
+      WHERE id = $9 AND workout_id = $10
+      RETURNING exercise_name, exercise_id
     `
-		_, err := tx.Exec(query, workout.ID, entry.ExerciseName, entry.Sets, entry.Reps, entry.DurationSeconds, entry.Weight, entry.Notes, entry.OrderIndex)
+		err = tx.QueryRow(query, entry.ExerciseName, entry.Sets, entry.Reps, entry.DurationSeconds, entry.Weight, entry.Notes, entry.OrderIndex, entry.ExerciseID, entry.ID, workout.ID, workout.UserID, groupID(workout, entry), entry.Distance).Scan(&entry.ExerciseName, &entry.ExerciseID)
+		if err != nil {
+			return translateEntryError(err)
+		}
 
+		err = saveSets(tx, entry)
 		if err != nil {
 			return err
 		}
+		if len(entry.SetDetails) == 0 {
+			entry.SetDetails = legacySets(*entry)
+		}
 	}
 
-	return tx.Commit()
+	return nil
+}
+
+// insertEntry stores a new entry. An entry given only an exercise_id takes
+// the exercise's name, and one given only a name is linked to the exercise
+// with that name or alias, if any.
+func insertEntry(tx *sql.Tx, workout *Workout, entry *WorkoutEntry) error {
+	normalizeSets(entry)
+	summarizeSets(entry)
+
+	query := `
+  INSERT INTO workout_entries (workout_id, exercise_name, sets, reps, duration_seconds, weight, notes, order_index, exercise_id, group_id, distance_meters)
+  VALUES ($1, COALESCE(NULLIF($2, ''), (SELECT name FROM exercises WHERE id = $9), ''), $3, $4, $5, $6, $7, $8, COALESCE($9, match_exercise_exactly($2, $10)), $11, $12)
+  RETURNING id, exercise_name, exercise_id
+  `
+
+	err := tx.QueryRow(query, workout.ID, entry.ExerciseName, entry.Sets, entry.Reps, entry.DurationSeconds, entry.Weight, entry.Notes, entry.OrderIndex, entry.ExerciseID, workout.UserID, groupID(workout, entry), entry.Distance).Scan(&entry.ID, &entry.ExerciseName, &entry.ExerciseID)
+	if err != nil {
+		return translateEntryError(err)
+	}
+
+	if len(entry.SetDetails) == 0 {
+		entry.SetDetails = legacySets(*entry)
+		return nil
+	}
+
+	return saveSets(tx, entry)
+}
+
+// checkExercises makes sure every exercise the entries reference is either
+// global or owned by the workout's owner.
+func checkExercises(tx *sql.Tx, workout *Workout) error {
+	ids := map[int64]bool{}
+	for _, entry := range workout.Entries {
+		if entry.ExerciseID != nil {
+			ids[int64(*entry.ExerciseID)] = true
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	referenced := make([]int64, 0, len(ids))
+	for id := range ids {
+		referenced = append(referenced, id)
+	}
+
+	var usable int
+	query := `
+  SELECT COUNT(*)
+  FROM exercises
+  WHERE id = ANY($1) AND (owner_id IS NULL OR owner_id = $2)
+  `
+	err := tx.QueryRow(query, referenced, workout.UserID).Scan(&usable)
+	if err != nil {
+		return err
+	}
+
+	if usable != len(referenced) {
+		return ErrUnknownExercise
+	}
+
+	return nil
 }
 
-func (pg *PostgresWorkoutStore) Delete(id int64) error {
+// translateEntryError reports references to missing exercises as
+// ErrUnknownExercise.
+func translateEntryError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolationCode && pgErr.ConstraintName == "workout_entries_exercise_id_fkey" {
+		return ErrUnknownExercise
+	}
+	return err
+}
+
+// Delete moves a workout to the trash if it is still at version. Trashed
+// workouts are hidden from reads until they are restored or purged.
+func (pg *PostgresWorkoutStore) Delete(id int64, version int) error {
+	query := `
+    UPDATE workouts
+    SET deleted_at = NOW()
+    WHERE id = $1 AND version = $2 AND deleted_at IS NULL
+  `
+
+	err := pg.execAffectingOne(query, id, version)
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	var exists bool
+	err = pg.db.QueryRow("SELECT EXISTS (SELECT 1 FROM workouts WHERE id = $1 AND deleted_at IS NULL)", id).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		return ErrVersionConflict
+	}
+
+	return sql.ErrNoRows
+}
+
+func (pg *PostgresWorkoutStore) Restore(id int64) error {
+	query := `
+    UPDATE workouts
+    SET deleted_at = NULL
+    WHERE id = $1 AND deleted_at IS NOT NULL
+  `
+
+	return pg.execAffectingOne(query, id)
+}
+
+func (pg *PostgresWorkoutStore) DeletePermanently(id int64) error {
 	query := `
     DELETE FROM workouts
     WHERE id = $1
   `
 
-	result, err := pg.db.Exec(query, id)
+	return pg.execAffectingOne(query, id)
+}
+
+func (pg *PostgresWorkoutStore) PurgeDeleted(before time.Time) (int64, error) {
+	query := `
+    DELETE FROM workouts
+    WHERE deleted_at < $1
+  `
+
+	result, err := pg.db.Exec(query, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func (pg *PostgresWorkoutStore) execAffectingOne(query string, args ...any) error {
+	result, err := pg.db.Exec(query, args...)
 	if err != nil {
 		return err
 	}
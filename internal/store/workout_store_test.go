@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
+	_ "github.com/joao-vitor-felix/workout-api/migrations"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -101,6 +102,53 @@ func TestCreateWorkout(t *testing.T) {
 	}
 }
 
+func createTestUser(t *testing.T, db *sql.DB, username string) *User {
+	user := &User{Username: username, Email: username + "@example.com"}
+	require.NoError(t, user.PasswordHash.Set("password"))
+	created, err := NewPostgresUserStore(db).Create(user)
+	require.NoError(t, err)
+	return created
+}
+
+func TestListByUser(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+	_, err := db.Exec("TRUNCATE TABLE users RESTART IDENTITY CASCADE")
+	require.NoError(t, err)
+	store := NewPostgresWorkoutStore(db)
+
+	owner := createTestUser(t, db, "owner")
+	other := createTestUser(t, db, "other")
+
+	for _, workout := range []*Workout{
+		{UserID: owner.ID, Title: "Leg Day", DurationMinutes: 60, CaloriesBurned: 400},
+		{UserID: owner.ID, Title: "Morning Run", DurationMinutes: 30, CaloriesBurned: 300},
+		{UserID: owner.ID, Title: "Evening Run", DurationMinutes: 45, CaloriesBurned: 450},
+		{UserID: other.ID, Title: "Run", DurationMinutes: 45, CaloriesBurned: 450},
+	} {
+		_, err := store.Create(workout)
+		require.NoError(t, err)
+	}
+
+	firstPage, next, err := store.ListByUser(owner.ID, WorkoutFilter{Limit: 2})
+	require.NoError(t, err)
+	require.Len(t, firstPage, 2)
+	require.NotNil(t, next)
+	assert.Equal(t, "Evening Run", firstPage[0].Title)
+	assert.Equal(t, "Morning Run", firstPage[1].Title)
+
+	secondPage, next, err := store.ListByUser(owner.ID, WorkoutFilter{Limit: 2, Cursor: next})
+	require.NoError(t, err)
+	require.Len(t, secondPage, 1)
+	assert.Nil(t, next)
+	assert.Equal(t, "Leg Day", secondPage[0].Title)
+
+	filtered, _, err := store.ListByUser(owner.ID, WorkoutFilter{Limit: 10, Title: "run", MinDuration: IntPtr(40)})
+	require.NoError(t, err)
+	require.Len(t, filtered, 1)
+	assert.Equal(t, "Evening Run", filtered[0].Title)
+}
+
 func IntPtr(i int) *int {
 	return &i
 }
@@ -4,19 +4,78 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base32"
+	"encoding/hex"
 	"time"
 )
 
 const (
-	ScopeAuth = "authentication"
+	ScopeAuth    = "authentication"
+	ScopeRefresh = "refresh"
+
+	ScopePasswordReset = "password-reset"
+	ScopeActivation    = "activation"
+	ScopeTwoFactor     = "2fa-pending"
+)
+
+const (
+	APIKeyPrefix = "wk_"
+	// APIKeyDisplayLength is how many leading characters of an API key are kept
+	// in clear so users can tell their keys apart.
+	APIKeyDisplayLength = len(APIKeyPrefix) + 8
 )
 
+const (
+	PermissionAll            = "*"
+	PermissionWorkoutsRead   = "workouts:read"
+	PermissionWorkoutsWrite  = "workouts:write"
+	PermissionProfileRead    = "profile:read"
+	PermissionProfileWrite   = "profile:write"
+	PermissionSessionsManage = "sessions:manage"
+	PermissionAPIKeysManage  = "api-keys:manage"
+	PermissionAccountManage  = "account:manage"
+	PermissionAdmin          = "admin"
+)
+
+// APIKeyPermissions lists the permissions that can be granted to an API key.
+// Managing sessions, API keys and account credentials is reserved to
+// interactive sign-ins.
+var APIKeyPermissions = []string{
+	PermissionWorkoutsRead,
+	PermissionWorkoutsWrite,
+	PermissionProfileRead,
+	PermissionProfileWrite,
+}
+
+type Permissions []string
+
+func (p Permissions) Has(permission string) bool {
+	for _, granted := range p {
+		if granted == PermissionAll || granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func IsGrantable(permission string) bool {
+	for _, grantable := range APIKeyPermissions {
+		if grantable == permission {
+			return true
+		}
+	}
+	return false
+}
+
 type Token struct {
-	PlainText string    `json:"token"`
-	Hash      []byte    `json:"-"`
-	Scope     string    `json:"-"`
-	UserID    int       `json:"-"`
-	ExpiresAt time.Time `json:"expires_at"`
+	PlainText   string    `json:"token"`
+	Hash        []byte    `json:"-"`
+	Scope       string    `json:"-"`
+	UserID      int       `json:"-"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	DeviceLabel string    `json:"-"`
+	UserAgent   string    `json:"-"`
+	IPAddress   string    `json:"-"`
+	FamilyID    string    `json:"-"`
 }
 
 func GenerateToken(userId int, ttl time.Duration, scope string) (*Token, error) {
@@ -31,7 +90,32 @@ func GenerateToken(userId int, ttl time.Duration, scope string) (*Token, error)
 		return nil, err
 	}
 	token.PlainText = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
-	hash := sha256.Sum256([]byte(token.PlainText))
-	token.Hash = hash[:]
+	token.Hash = Hash(token.PlainText)
+	return token, nil
+}
+
+func GenerateAPIKey(userId int) (*Token, error) {
+	token, err := GenerateToken(userId, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	token.PlainText = APIKeyPrefix + token.PlainText
+	token.Hash = Hash(token.PlainText)
+	token.ExpiresAt = time.Time{}
 	return token, nil
 }
+
+func Hash(plainText string) []byte {
+	hash := sha256.Sum256([]byte(plainText))
+	return hash[:]
+}
+
+// NewFamilyID returns an identifier shared by every token issued from the same sign-in.
+func NewFamilyID() (string, error) {
+	randomBytes := make([]byte, 16)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(randomBytes), nil
+}
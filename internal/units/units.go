@@ -0,0 +1,77 @@
+// Package units converts weights and distances between the canonical SI
+// values that are stored and the unit systems users work in.
+package units
+
+import "math"
+
+const (
+	// Metric shows weights in kilograms and distances in kilometers.
+	Metric = "metric"
+	// Imperial shows weights in pounds and distances in miles.
+	Imperial = "imperial"
+)
+
+const (
+	kilogramsPerPound  = 0.45359237
+	metersPerKilometer = 1000
+	metersPerMile      = 1609.344
+)
+
+func IsValid(system string) bool {
+	return system == Metric || system == Imperial
+}
+
+// WeightUnit names the unit weights are shown in.
+func WeightUnit(system string) string {
+	if system == Imperial {
+		return "lb"
+	}
+	return "kg"
+}
+
+// DistanceUnit names the unit distances are shown in.
+func DistanceUnit(system string) string {
+	if system == Imperial {
+		return "mi"
+	}
+	return "km"
+}
+
+// FromKilograms converts a stored weight for display, rounded to hundredths.
+func FromKilograms(kg float64, system string) float64 {
+	if system == Imperial {
+		kg /= kilogramsPerPound
+	}
+	return round(kg, 2)
+}
+
+// ToKilograms converts a weight given in system to kilograms, rounded to the
+// stored precision.
+func ToKilograms(weight float64, system string) float64 {
+	if system == Imperial {
+		weight *= kilogramsPerPound
+	}
+	return round(weight, 3)
+}
+
+// FromMeters converts a stored distance for display, rounded to thousandths.
+func FromMeters(meters float64, system string) float64 {
+	if system == Imperial {
+		return round(meters/metersPerMile, 3)
+	}
+	return round(meters/metersPerKilometer, 3)
+}
+
+// ToMeters converts a distance given in system to meters, rounded to the
+// stored precision.
+func ToMeters(distance float64, system string) float64 {
+	if system == Imperial {
+		return round(distance*metersPerMile, 3)
+	}
+	return round(distance*metersPerKilometer, 3)
+}
+
+func round(value float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(value*scale) / scale
+}
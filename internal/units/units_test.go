@@ -0,0 +1,33 @@
+package units
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWeights(t *testing.T) {
+	assert.Equal(t, 100.0, FromKilograms(100, Metric))
+	assert.Equal(t, 220.46, FromKilograms(100, Imperial))
+	assert.Equal(t, 102.058, ToKilograms(225, Imperial))
+	assert.Equal(t, 62.5, ToKilograms(62.5, Metric))
+
+	// a weight read in pounds and sent back unchanged keeps its stored value
+	stored := ToKilograms(225, Imperial)
+	assert.Equal(t, 225.0, FromKilograms(stored, Imperial))
+	assert.Equal(t, stored, ToKilograms(FromKilograms(stored, Imperial), Imperial))
+}
+
+func TestDistances(t *testing.T) {
+	assert.Equal(t, 5.0, FromMeters(5000, Metric))
+	assert.Equal(t, 3.107, FromMeters(5000, Imperial))
+	assert.Equal(t, 1609.344, ToMeters(1, Imperial))
+	assert.Equal(t, 21097.5, ToMeters(21.0975, Metric))
+}
+
+func TestIsValid(t *testing.T) {
+	assert.True(t, IsValid(Metric))
+	assert.True(t, IsValid(Imperial))
+	assert.False(t, IsValid(""))
+	assert.False(t, IsValid("kg"))
+}
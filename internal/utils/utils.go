@@ -3,6 +3,7 @@ package utils
 import (
 	"encoding/json"
 	"errors"
+	"net"
 	"net/http"
 	"strconv"
 
@@ -30,13 +31,25 @@ func WriteJSON(w http.ResponseWriter, status int, data Envelope) error {
 }
 
 func ReadIdParam(r *http.Request) (int64, error) {
-	idParam := chi.URLParam(r, "id")
-	if idParam == "" {
-		return 0, errors.New("id parameter is required")
+	return ReadIntParam(r, "id")
+}
+
+func ReadIntParam(r *http.Request, name string) (int64, error) {
+	param := chi.URLParam(r, name)
+	if param == "" {
+		return 0, errors.New(name + " parameter is required")
+	}
+	value, err := strconv.ParseInt(param, 10, 64)
+	if err != nil {
+		return 0, errors.New("invalid " + name + " parameter")
 	}
-	id, err := strconv.ParseInt(idParam, 10, 64)
+	return value, nil
+}
+
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
 	if err != nil {
-		return 0, errors.New("invalid id parameter")
+		return r.RemoteAddr
 	}
-	return id, nil
+	return host
 }
@@ -0,0 +1,29 @@
+package validator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidator(t *testing.T) {
+	v := New()
+	assert.True(t, v.Valid())
+
+	v.Check(NotBlank("  "), "title", "title is required")
+	v.Check(MaxChars("abcd", 3), "title", "title is too long")
+	v.Check(PermittedValue("public", "private", "public"), "visibility", "invalid visibility")
+	v.Check(Matches("not-an-email", EmailRX), "email", "invalid email format")
+
+	assert.False(t, v.Valid())
+	assert.Equal(t, map[string]string{
+		"title": "title is required",
+		"email": "invalid email format",
+	}, v.Errors)
+}
+
+func TestChars(t *testing.T) {
+	assert.True(t, MaxChars("ñañá", 4))
+	assert.False(t, MinChars("ñañ", 4))
+	assert.True(t, NotBlank(" x "))
+}
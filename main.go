@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"net/http"
@@ -27,6 +28,11 @@ func main() {
 	}
 
 	defer app.DBPool.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go app.RunTrashPurge(ctx)
+
 	r := routes.SetupRoutes(app)
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%d", port),
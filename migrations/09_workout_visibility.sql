@@ -0,0 +1,17 @@
+-- +goose Up
+ALTER TABLE workouts
+ADD COLUMN visibility VARCHAR(20) NOT NULL DEFAULT 'private',
+ADD CONSTRAINT valid_visibility CHECK (visibility IN ('private', 'followers', 'public'));
+
+CREATE TABLE IF NOT EXISTS follows (
+  follower_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  followee_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (follower_id, followee_id)
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS follows;
+ALTER TABLE workouts
+DROP CONSTRAINT valid_visibility,
+DROP COLUMN visibility;
@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE tokens
+ADD COLUMN id BIGSERIAL UNIQUE,
+ADD COLUMN device_label VARCHAR(100),
+ADD COLUMN user_agent TEXT,
+ADD COLUMN ip_address VARCHAR(45),
+ADD COLUMN last_used_at TIMESTAMP WITH TIME ZONE;
+
+-- +goose Down
+ALTER TABLE tokens
+DROP COLUMN last_used_at,
+DROP COLUMN ip_address,
+DROP COLUMN user_agent,
+DROP COLUMN device_label,
+DROP COLUMN id;
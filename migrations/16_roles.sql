@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'user',
+ADD COLUMN disabled_at TIMESTAMP WITH TIME ZONE,
+ADD CONSTRAINT valid_role CHECK (role IN ('user', 'coach', 'admin'));
+
+-- +goose Down
+ALTER TABLE users
+DROP CONSTRAINT valid_role,
+DROP COLUMN disabled_at,
+DROP COLUMN role;
@@ -0,0 +1,10 @@
+-- +goose Up
+ALTER TABLE workouts
+ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_workouts_deleted_at ON workouts (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_workouts_deleted_at;
+ALTER TABLE workouts
+DROP COLUMN deleted_at;
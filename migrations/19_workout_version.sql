@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE workouts ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+
+-- +goose Down
+ALTER TABLE workouts DROP COLUMN IF EXISTS version;
@@ -0,0 +1,15 @@
+-- +goose Up
+UPDATE workout_entries e
+SET order_index = ordered.position
+FROM (
+  SELECT id, ROW_NUMBER() OVER (PARTITION BY workout_id ORDER BY order_index, id) AS position
+  FROM workout_entries
+) ordered
+WHERE e.id = ordered.id;
+
+ALTER TABLE workout_entries
+ADD CONSTRAINT workout_entries_order_unique UNIQUE (workout_id, order_index) DEFERRABLE INITIALLY DEFERRED;
+
+-- +goose Down
+ALTER TABLE workout_entries
+DROP CONSTRAINT IF EXISTS workout_entries_order_unique;
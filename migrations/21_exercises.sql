@@ -0,0 +1,50 @@
+-- +goose Up
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE TABLE IF NOT EXISTS exercises (
+  id BIGSERIAL PRIMARY KEY,
+  name VARCHAR(255) NOT NULL,
+  aliases TEXT[] NOT NULL DEFAULT '{}',
+  muscle_groups TEXT[] NOT NULL DEFAULT '{}',
+  equipment TEXT[] NOT NULL DEFAULT '{}',
+  type VARCHAR(10) NOT NULL DEFAULT 'reps',
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  CONSTRAINT valid_exercise_type CHECK (type IN ('reps', 'time'))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_exercises_name ON exercises (LOWER(name));
+CREATE INDEX IF NOT EXISTS idx_exercises_name_trgm ON exercises USING GIN (name gin_trgm_ops);
+
+ALTER TABLE workout_entries
+ADD COLUMN exercise_id BIGINT REFERENCES exercises(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_workout_entries_exercise_id ON workout_entries (exercise_id);
+
+-- match_exercise finds the catalog exercise a free-text name most likely
+-- refers to: an exact name or alias first, then the closest trigram match.
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION match_exercise(entry_name TEXT) RETURNS BIGINT AS $$
+  SELECT id
+  FROM (
+    SELECT e.id,
+      CASE
+        WHEN LOWER(e.name) = LOWER(TRIM(entry_name)) THEN 2::REAL
+        WHEN EXISTS (SELECT 1 FROM unnest(e.aliases) a WHERE LOWER(a) = LOWER(TRIM(entry_name))) THEN 1.5::REAL
+        ELSE GREATEST(
+          similarity(e.name, entry_name),
+          COALESCE((SELECT MAX(similarity(a, entry_name)) FROM unnest(e.aliases) a), 0)
+        )
+      END AS score
+    FROM exercises e
+  ) scored
+  WHERE score >= 0.5
+  ORDER BY score DESC, id
+  LIMIT 1
+$$ LANGUAGE SQL STABLE;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP FUNCTION IF EXISTS match_exercise(TEXT);
+ALTER TABLE workout_entries DROP COLUMN IF EXISTS exercise_id;
+DROP TABLE IF EXISTS exercises;
@@ -0,0 +1,62 @@
+-- +goose Up
+ALTER TABLE exercises
+ADD COLUMN owner_id BIGINT REFERENCES users(id) ON DELETE CASCADE;
+
+DROP INDEX IF EXISTS idx_exercises_name;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_exercises_global_name ON exercises (LOWER(name)) WHERE owner_id IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_exercises_owner_name ON exercises (owner_id, LOWER(name)) WHERE owner_id IS NOT NULL;
+
+DROP FUNCTION IF EXISTS match_exercise(TEXT);
+
+-- match_exercise only considers the global catalog and the exercises of the
+-- user the entry belongs to, preferring the user's own on equal scores.
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION match_exercise(entry_name TEXT, entry_owner BIGINT) RETURNS BIGINT AS $$
+  SELECT id
+  FROM (
+    SELECT e.id, e.owner_id,
+      CASE
+        WHEN LOWER(e.name) = LOWER(TRIM(entry_name)) THEN 2::REAL
+        WHEN EXISTS (SELECT 1 FROM unnest(e.aliases) a WHERE LOWER(a) = LOWER(TRIM(entry_name))) THEN 1.5::REAL
+        ELSE GREATEST(
+          similarity(e.name, entry_name),
+          COALESCE((SELECT MAX(similarity(a, entry_name)) FROM unnest(e.aliases) a), 0)
+        )
+      END AS score
+    FROM exercises e
+    WHERE e.owner_id IS NULL OR e.owner_id = entry_owner
+  ) scored
+  WHERE score >= 0.5
+  ORDER BY score DESC, owner_id IS NULL, id
+  LIMIT 1
+$$ LANGUAGE SQL STABLE;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP FUNCTION IF EXISTS match_exercise(TEXT, BIGINT);
+DELETE FROM exercises WHERE owner_id IS NOT NULL;
+DROP INDEX IF EXISTS idx_exercises_owner_name;
+DROP INDEX IF EXISTS idx_exercises_global_name;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_exercises_name ON exercises (LOWER(name));
+ALTER TABLE exercises DROP COLUMN IF EXISTS owner_id;
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION match_exercise(entry_name TEXT) RETURNS BIGINT AS $$
+  SELECT id
+  FROM (
+    SELECT e.id,
+      CASE
+        WHEN LOWER(e.name) = LOWER(TRIM(entry_name)) THEN 2::REAL
+        WHEN EXISTS (SELECT 1 FROM unnest(e.aliases) a WHERE LOWER(a) = LOWER(TRIM(entry_name))) THEN 1.5::REAL
+        ELSE GREATEST(
+          similarity(e.name, entry_name),
+          COALESCE((SELECT MAX(similarity(a, entry_name)) FROM unnest(e.aliases) a), 0)
+        )
+      END AS score
+    FROM exercises e
+  ) scored
+  WHERE score >= 0.5
+  ORDER BY score DESC, id
+  LIMIT 1
+$$ LANGUAGE SQL STABLE;
+-- +goose StatementEnd
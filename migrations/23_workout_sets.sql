@@ -0,0 +1,23 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS workout_sets (
+  id BIGSERIAL PRIMARY KEY,
+  entry_id BIGINT NOT NULL REFERENCES workout_entries(id) ON DELETE CASCADE,
+  set_number INT NOT NULL,
+  set_type VARCHAR(10) NOT NULL DEFAULT 'working' CHECK (set_type IN ('warmup', 'working', 'drop', 'failure')),
+  reps INT CHECK (reps >= 0),
+  duration_seconds INT CHECK (duration_seconds > 0),
+  weight DECIMAL(5, 2) CHECK (weight >= 0),
+  rpe DECIMAL(3, 1) CHECK (rpe BETWEEN 1 AND 10),
+  rir INT CHECK (rir >= 0),
+  completed BOOLEAN NOT NULL DEFAULT TRUE,
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+
+  CONSTRAINT workout_sets_number_unique UNIQUE (entry_id, set_number),
+  CONSTRAINT valid_workout_set CHECK (
+    (reps IS NOT NULL OR duration_seconds IS NOT NULL) AND
+    (reps IS NULL OR duration_seconds IS NULL)
+  )
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS workout_sets;
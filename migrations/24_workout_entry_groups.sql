@@ -0,0 +1,22 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS workout_entry_groups (
+  id BIGSERIAL PRIMARY KEY,
+  workout_id BIGINT NOT NULL REFERENCES workouts(id) ON DELETE CASCADE,
+  label VARCHAR(10) NOT NULL,
+  group_type VARCHAR(10) NOT NULL CHECK (group_type IN ('superset', 'circuit', 'emom', 'amrap')),
+  rounds INT NOT NULL DEFAULT 1 CHECK (rounds > 0),
+  created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+  updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+
+  CONSTRAINT workout_entry_groups_label_unique UNIQUE (workout_id, label)
+);
+
+ALTER TABLE workout_entries
+ADD COLUMN group_id BIGINT REFERENCES workout_entry_groups(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_workout_entries_group_id ON workout_entries (group_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_workout_entries_group_id;
+ALTER TABLE workout_entries DROP COLUMN IF EXISTS group_id;
+DROP TABLE IF EXISTS workout_entry_groups;
@@ -0,0 +1,29 @@
+-- +goose Up
+-- weights are kilograms and distances meters; existing weights had no unit
+-- and are taken to be kilograms
+ALTER TABLE workout_entries
+ALTER COLUMN weight TYPE NUMERIC(9, 3),
+ADD COLUMN distance_meters NUMERIC(12, 3) CHECK (distance_meters >= 0);
+
+ALTER TABLE workout_sets
+ALTER COLUMN weight TYPE NUMERIC(9, 3),
+ADD COLUMN distance_meters NUMERIC(12, 3) CHECK (distance_meters >= 0);
+
+ALTER TABLE users
+ADD COLUMN units VARCHAR(10) NOT NULL DEFAULT 'metric' CHECK (units IN ('metric', 'imperial'));
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN IF EXISTS units;
+
+-- DECIMAL(5, 2) can't hold the heavier weights this migration allowed; they
+-- are dropped rather than stored as a weight nobody logged
+UPDATE workout_sets SET weight = NULL WHERE ROUND(weight, 2) > 999.99;
+UPDATE workout_entries SET weight = NULL WHERE ROUND(weight, 2) > 999.99;
+
+ALTER TABLE workout_sets
+DROP COLUMN IF EXISTS distance_meters,
+ALTER COLUMN weight TYPE DECIMAL(5, 2);
+
+ALTER TABLE workout_entries
+DROP COLUMN IF EXISTS distance_meters,
+ALTER COLUMN weight TYPE DECIMAL(5, 2);
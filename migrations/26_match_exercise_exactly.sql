@@ -0,0 +1,20 @@
+-- +goose Up
+-- match_exercise_exactly links new entries only to an exercise whose name or
+-- alias is the entry's name. Fuzzy matching is left to the one-time backfill
+-- of existing entries, where a wrong guess can be reviewed.
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION match_exercise_exactly(entry_name TEXT, entry_owner BIGINT) RETURNS BIGINT AS $$
+  SELECT e.id
+  FROM exercises e
+  WHERE (e.owner_id IS NULL OR e.owner_id = entry_owner)
+    AND (
+      LOWER(e.name) = LOWER(TRIM(entry_name))
+      OR EXISTS (SELECT 1 FROM unnest(e.aliases) a WHERE LOWER(a) = LOWER(TRIM(entry_name)))
+    )
+  ORDER BY LOWER(e.name) = LOWER(TRIM(entry_name)) DESC, e.owner_id IS NULL, e.id
+  LIMIT 1
+$$ LANGUAGE SQL STABLE;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP FUNCTION IF EXISTS match_exercise_exactly(TEXT, BIGINT);
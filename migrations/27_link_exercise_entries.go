@@ -0,0 +1,71 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/joao-vitor-felix/workout-api/seeds"
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigrationContext(upLinkExerciseEntries, downLinkExerciseEntries)
+}
+
+// upLinkExerciseEntries links entries logged before the exercise catalog to
+// the exercise their name matches best. The catalog is seeded first so that
+// databases upgrading past the exercises migrations in one go have something
+// to match against; seeding again at startup leaves these exercises alone.
+func upLinkExerciseEntries(ctx context.Context, tx *sql.Tx) error {
+	data, err := seeds.FS.ReadFile("exercises.json")
+	if err != nil {
+		return err
+	}
+
+	var exercises []struct {
+		Name         string   `json:"name"`
+		Aliases      []string `json:"aliases"`
+		MuscleGroups []string `json:"muscle_groups"`
+		Equipment    []string `json:"equipment"`
+		Type         string   `json:"type"`
+	}
+	err = json.Unmarshal(data, &exercises)
+	if err != nil {
+		return fmt.Errorf("parse exercises.json: %w", err)
+	}
+
+	query := `
+  INSERT INTO exercises (name, aliases, muscle_groups, equipment, type)
+  VALUES ($1, COALESCE($2, '{}'::TEXT[]), COALESCE($3, '{}'::TEXT[]), COALESCE($4, '{}'::TEXT[]), $5)
+  ON CONFLICT ((LOWER(name))) WHERE owner_id IS NULL DO NOTHING
+  `
+	for _, exercise := range exercises {
+		_, err = tx.ExecContext(ctx, query, exercise.Name, exercise.Aliases, exercise.MuscleGroups, exercise.Equipment, exercise.Type)
+		if err != nil {
+			return fmt.Errorf("seed exercise %q: %w", exercise.Name, err)
+		}
+	}
+
+	// this runs once, so entries whose exercise is deleted later keep just
+	// their name instead of being matched to another one
+	_, err = tx.ExecContext(ctx, `
+  UPDATE workout_entries e
+  SET exercise_id = matched.exercise_id
+  FROM (
+    SELECT e.id, match_exercise(e.exercise_name, w.user_id) AS exercise_id
+    FROM workout_entries e
+    JOIN workouts w ON w.id = e.workout_id
+    WHERE e.exercise_id IS NULL
+  ) matched
+  WHERE matched.id = e.id AND matched.exercise_id IS NOT NULL
+  `)
+	return err
+}
+
+// downLinkExerciseEntries keeps the links: they can't be told apart from the
+// ones users made themselves.
+func downLinkExerciseEntries(ctx context.Context, tx *sql.Tx) error {
+	return nil
+}
@@ -0,0 +1,34 @@
+package seeds
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExercisesSeed(t *testing.T) {
+	data, err := FS.ReadFile("exercises.json")
+	require.NoError(t, err)
+
+	var exercises []struct {
+		Name         string   `json:"name"`
+		Aliases      []string `json:"aliases"`
+		MuscleGroups []string `json:"muscle_groups"`
+		Type         string   `json:"type"`
+	}
+	require.NoError(t, json.Unmarshal(data, &exercises))
+	require.NotEmpty(t, exercises)
+
+	names := map[string]bool{}
+	for _, exercise := range exercises {
+		name := strings.ToLower(exercise.Name)
+		assert.False(t, names[name], "duplicate exercise %q", exercise.Name)
+		names[name] = true
+
+		assert.Contains(t, []string{"reps", "time"}, exercise.Type, exercise.Name)
+		assert.NotEmpty(t, exercise.MuscleGroups, exercise.Name)
+	}
+}